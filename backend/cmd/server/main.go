@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -12,37 +16,134 @@ import (
 	"time"
 
 	"github.com/user/subfinder-service/backend/internal/api"
+	"github.com/user/subfinder-service/backend/internal/auth"
+	"github.com/user/subfinder-service/backend/internal/config"
+	"github.com/user/subfinder-service/backend/internal/logging"
+	"github.com/user/subfinder-service/backend/internal/metrics"
+	"github.com/user/subfinder-service/backend/internal/providers"
 	"github.com/user/subfinder-service/backend/internal/queue"
+	"github.com/user/subfinder-service/backend/internal/retention"
+	"github.com/user/subfinder-service/backend/internal/scheduler"
+	"github.com/user/subfinder-service/backend/internal/subfinder"
+	"github.com/user/subfinder-service/backend/internal/tracing"
+	"github.com/user/subfinder-service/backend/internal/webhook"
 	"github.com/user/subfinder-service/backend/internal/worker"
 )
 
 func main() {
+	// Load the configuration from the config file, environment and flags
+	cfg, printConfig, err := config.Load(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if printConfig {
+		out, err := cfg.YAML()
+		if err != nil {
+			log.Fatalf("Failed to print configuration: %v", err)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+
 	// Set up logger
-	logger := log.New(os.Stdout, "[SUBFINDER-SERVICE] ", log.LstdFlags)
-	logger.Println("Starting subfinder service...")
+	logger, err := logging.New(os.Stdout, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	slog.SetDefault(logger)
+	logger.Info("Starting subfinder service")
 
-	if err := checkSubfinder(logger); err != nil {
-		logger.Fatalf("subfinder not available: %v", err)
+	// Set up tracing, exporting spans if an OTLP endpoint is configured
+	shutdownTracing, exporting, err := tracing.Setup(context.Background())
+	if err != nil {
+		fatal(logger, "Failed to set up tracing", err)
+	}
+	if exporting {
+		logger.Info("Exporting traces over OTLP")
+	}
+
+	// Create job store
+	store, err := newJobStore(cfg.Store, logger)
+	if err != nil {
+		fatal(logger, "Failed to create job store", err)
 	}
+	defer store.Close()
 
 	// Create job queue
-	jobQueue := queue.NewJobQueue()
+	jobQueue := newJobQueue(store, cfg.Queue.Capacity, logger)
+
+	// Send webhook notifications when jobs finish, including jobs failed while restoring
+	notifier := webhook.NewNotifier(jobQueue, logger)
+
+	// Restore jobs left over from a previous run
+	requeued, interrupted, err := jobQueue.Restore()
+	if err != nil {
+		fatal(logger, "Failed to restore jobs", err)
+	}
+	if requeued > 0 || interrupted > 0 {
+		logger.Info("Restored jobs", "requeued", requeued, "interrupted", interrupted)
+	}
+
+	// Report the queue state on /metrics
+	metrics.RegisterQueue(jobQueue)
+
+	// Keep API keys of the passive sources encrypted in the job store
+	providerKeys, err := newProviderManager(store, cfg.Providers.EncryptionKey, logger)
+	if err != nil {
+		fatal(logger, "Failed to create provider key store", err)
+	}
+	var keySource subfinder.KeySource
+	if providerKeys != nil {
+		keySource = providerKeys
+	}
+
+	// Create subfinder client
+	enumerator, err := newEnumerator(cfg.Subfinder, keySource, logger)
+	if err != nil {
+		fatal(logger, "Failed to create subfinder client", err)
+	}
 
 	// Create worker pool
-	workerCount := getEnvInt("WORKER_COUNT", 5)
-	workerPool := worker.NewWorkerPool(workerCount, jobQueue, logger)
+	workerPool := worker.NewWorkerPool(cfg.Workers, jobQueue, enumerator, logger)
 
 	// Start worker pool
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	jobQueue.Start(ctx)
 	workerPool.Start(ctx)
 
+	// Purge old jobs in the background if a retention policy is configured
+	policy := cfg.RetentionPolicy()
+	var janitor *retention.Janitor
+	if policy.Enabled() {
+		janitor = retention.NewJanitor(jobQueue, policy, time.Duration(cfg.Retention.Interval), logger)
+		janitor.Start(ctx)
+	}
+
+	// Require API keys if authentication is enabled
+	keys, err := newKeyManager(store, cfg.Auth, logger)
+	if err != nil {
+		fatal(logger, "Failed to set up authentication", err)
+	}
+
+	// Create and start scheduler for recurring scans
+	scheduleStore, err := newScheduleStore(store)
+	if err != nil {
+		fatal(logger, "Failed to create schedule store", err)
+	}
+	jobScheduler := scheduler.New(scheduleStore, jobQueue, keys, cfg.JobDefaults(), logger)
+	if err := jobScheduler.Start(); err != nil {
+		fatal(logger, "Failed to start scheduler", err)
+	}
+
 	// Create and start API server
-	port := getEnv("PORT", "8080")
-	server := api.NewServer(port, jobQueue, logger)
+	server := api.NewServer(cfg.Server.Port, jobQueue, jobScheduler, keys, providerKeys, cfg.Auth.AdminToken, cfg.JobDefaults(), logger)
 	go func() {
-		if err := server.Start(); err != nil {
-			logger.Fatalf("Failed to start server: %v", err)
+		if err := server.Start(); err != nil && err != http.ErrServerClosed {
+			fatal(logger, "Failed to start server", err)
 		}
 	}()
 
@@ -52,48 +153,154 @@ func main() {
 	<-quit
 
 	// Graceful shutdown
-	logger.Println("Shutting down server...")
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	logger.Info("Shutting down server")
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownGrace))
 	defer shutdownCancel()
 
 	if err := server.Shutdown(shutdownCtx); err != nil {
-		logger.Fatalf("Server forced to shutdown: %v", err)
+		fatal(logger, "Server forced to shutdown", err)
 	}
 
+	// Stop creating scheduled jobs
+	jobScheduler.Stop()
+
 	// Wait for worker pool to finish
 	cancel()
 	workerPool.Wait()
+	if janitor != nil {
+		janitor.Wait()
+	}
+
+	// Stop retrying webhook deliveries
+	notifier.Close()
+
+	// Flush pending spans, including those of the jobs that just stopped
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownGrace))
+	defer flushCancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		logger.Error("Failed to flush traces", "error", err)
+	}
+
+	logger.Info("Server exited properly")
+}
+
+// fatal logs err and exits
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// newJobStore creates the configured job store: "memory", "bolt", which persists
+// jobs to a BoltDB file, or "redis", which shares jobs between replicas through a Redis server.
+func newJobStore(cfg config.Store, logger *slog.Logger) (queue.JobStore, error) {
+	switch cfg.Kind {
+	case "memory":
+		logger.Info("Using in-memory job store")
+		return queue.NewMemoryStore(), nil
+	case "bolt":
+		logger.Info("Using BoltDB job store", "path", cfg.Path)
+		return queue.NewBoltStore(cfg.Path)
+	case "redis":
+		logger.Info("Using Redis job store", "prefix", cfg.RedisPrefix)
+		return queue.NewRedisStore(cfg.RedisURL, cfg.RedisPrefix)
+	default:
+		return nil, fmt.Errorf("unknown job store %q", cfg.Kind)
+	}
+}
 
-	logger.Println("Server exited properly")
+// newJobQueue creates the job queue. With the redis job store the queue is shared by
+// all replicas using the same Redis server and key prefix.
+func newJobQueue(store queue.JobStore, capacity int, logger *slog.Logger) *queue.JobQueue {
+	if redisStore, ok := store.(*queue.RedisStore); ok {
+		logger.Info("Sharing the job queue with other replicas through Redis")
+		return queue.NewClusterJobQueue(store, queue.NewRedisCluster(redisStore.Client(), redisStore.Prefix()), capacity)
+	}
+	return queue.NewJobQueue(store, capacity)
 }
 
-// getEnv returns the value of an environment variable or a default value if not set
-func getEnv(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+// newScheduleStore creates a schedule store matching the job store. Schedules are
+// kept in the same BoltDB file or Redis database as jobs when those job stores are used.
+func newScheduleStore(store queue.JobStore) (scheduler.Store, error) {
+	switch store := store.(type) {
+	case *queue.BoltStore:
+		return scheduler.NewBoltStore(store.DB())
+	case *queue.RedisStore:
+		return scheduler.NewRedisStore(store.Client(), store.Prefix()), nil
+	default:
+		return scheduler.NewMemoryStore(), nil
 	}
-	return defaultValue
 }
 
-// getEnvInt returns the integer value of an environment variable or a default value if not set
-func getEnvInt(key string, defaultValue int) int {
-	if value, exists := os.LookupEnv(key); exists {
-		if intValue, err := parseInt(value); err == nil {
-			return intValue
+// newKeyManager creates the API key manager if authentication is enabled, or returns nil
+// to leave the API open. Keys are kept in the same BoltDB file or Redis database as
+// jobs when those job stores are used.
+func newKeyManager(store queue.JobStore, cfg config.Auth, logger *slog.Logger) (*auth.Manager, error) {
+	if !cfg.Enabled {
+		logger.Warn("Authentication is disabled, the API is open to everyone")
+		return nil, nil
+	}
+
+	var keyStore auth.Store = auth.NewMemoryStore()
+	switch store := store.(type) {
+	case *queue.BoltStore:
+		var err error
+		if keyStore, err = auth.NewBoltStore(store.DB()); err != nil {
+			return nil, err
+		}
+	case *queue.RedisStore:
+		var err error
+		if keyStore, err = auth.NewRedisStore(store.Client(), store.Prefix()); err != nil {
+			return nil, err
 		}
 	}
-	return defaultValue
+
+	logger.Info("Authentication is enabled, requests require an API key")
+	return auth.NewManager(keyStore), nil
 }
 
-// parseInt converts a string to an integer
-func parseInt(value string) (int, error) {
-	var result int
-	_, err := fmt.Sscanf(value, "%d", &result)
-	return result, err
+// newProviderManager creates the provider key manager if an encryption key (secret) is set,
+// or returns nil to leave the provider config file as the only source of keys. Keys are
+// kept in the same BoltDB file or Redis database as jobs when those job stores are used.
+func newProviderManager(store queue.JobStore, secret string, logger *slog.Logger) (*providers.Manager, error) {
+	if secret == "" {
+		logger.Info("PROVIDER_ENCRYPTION_KEY is not set, provider keys can only be set in the provider config file")
+		return nil, nil
+	}
+
+	var keyStore providers.Store = providers.NewMemoryStore()
+	switch store := store.(type) {
+	case *queue.BoltStore:
+		var err error
+		if keyStore, err = providers.NewBoltStore(store.DB()); err != nil {
+			return nil, err
+		}
+	case *queue.RedisStore:
+		keyStore = providers.NewRedisStore(store.Client(), store.Prefix())
+	}
+
+	return providers.NewManager(keyStore, secret, subfinder.KeySources())
+}
+
+// newEnumerator creates the configured subfinder client: "library", which runs subfinder
+// in-process, or "cli", which runs the subfinder binary. Keys from keys, if not nil, are
+// added to the provider config.
+func newEnumerator(cfg config.Subfinder, keys subfinder.KeySource, logger *slog.Logger) (subfinder.Enumerator, error) {
+	switch cfg.Client {
+	case "library":
+		logger.Info("Using subfinder library client")
+		return subfinder.NewLibraryClient(cfg.ProviderConfig, keys, logger)
+	case "cli":
+		if err := checkSubfinder(logger); err != nil {
+			return nil, fmt.Errorf("subfinder not available: %v", err)
+		}
+		return subfinder.NewCLIClient(cfg.ProviderConfig, keys, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown subfinder client %q", cfg.Client)
+	}
 }
 
 // checkSubfinder verifies that the subfinder binary is available and logs its version.
-func checkSubfinder(logger *log.Logger) error {
+func checkSubfinder(logger *slog.Logger) error {
 	path, err := exec.LookPath("subfinder")
 	if err != nil {
 		return err
@@ -101,8 +308,8 @@ func checkSubfinder(logger *log.Logger) error {
 	cmd := exec.Command(path, "-version")
 	out, err := cmd.CombinedOutput()
 	if err != nil {
-		logger.Printf("failed to execute subfinder -version: %v", err)
+		logger.Warn("Failed to execute subfinder -version", "error", err)
 	}
-	logger.Printf("Using subfinder at %s version: %s", path, strings.TrimSpace(string(out)))
+	logger.Info("Using subfinder binary", "path", path, "version", strings.TrimSpace(string(out)))
 	return nil
 }
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/subfinder-service/backend/internal/auth"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// apiKeyContextKey is the gin context key holding the authenticated API key
+const apiKeyContextKey = "apiKey"
+
+// requireAPIKey rejects requests without a valid API key in the X-API-Key
+// header or as a bearer token
+func (s *Server) requireAPIKey(c *gin.Context) {
+	raw := c.GetHeader("X-API-Key")
+	if raw == "" {
+		raw = bearerToken(c)
+	}
+	if raw == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "API key is required",
+		})
+		return
+	}
+
+	key, err := s.auth.Authenticate(raw)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.Set(apiKeyContextKey, key)
+	c.Next()
+}
+
+// requireAdmin rejects requests without the admin token as a bearer token
+func (s *Server) requireAdmin(c *gin.Context) {
+	token := bearerToken(c)
+	if s.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Admin token is required",
+		})
+		return
+	}
+	c.Next()
+}
+
+// bearerToken returns the token of a bearer Authorization header
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// apiKey returns the API key that authenticated the request, or nil when
+// authentication is disabled
+func apiKey(c *gin.Context) *models.APIKey {
+	if value, ok := c.Get(apiKeyContextKey); ok {
+		return value.(*models.APIKey)
+	}
+	return nil
+}
+
+// reserve checks that the caller may submit count more jobs and counts them
+// against its quota. On success the returned function must be called once the
+// jobs are enqueued, with false if they were not, so concurrent submissions
+// with the same key cannot exceed its limits.
+func (s *Server) reserve(c *gin.Context, count int) (func(enqueued bool), error) {
+	key := apiKey(c)
+	if key == nil {
+		return func(bool) {}, nil
+	}
+	return s.auth.Reserve(key, count, s.queue.ActiveJobs, time.Now())
+}
+
+// respondReserveError answers a submission that reserve rejected
+func respondReserveError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, auth.ErrQuotaExceeded) {
+		status = http.StatusTooManyRequests
+	}
+	c.JSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
+
+// handleListKeys handles the list API keys endpoint
+func (s *Server) handleListKeys(c *gin.Context) {
+	keys := s.auth.List()
+	for _, key := range keys {
+		key.Hash = ""
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+// handleCreateKey handles the create API key endpoint
+func (s *Server) handleCreateKey(c *gin.Context) {
+	var request models.APIKeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request: %v", err),
+		})
+		return
+	}
+
+	key, raw, err := s.auth.Create(request)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrInvalidLimits) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	s.logger.InfoContext(c.Request.Context(), "Created API key", "key_id", key.ID, "key_prefix", key.Prefix, "key_name", key.Name)
+
+	key.Hash = ""
+	c.JSON(http.StatusCreated, models.APIKeyResponse{
+		APIKey: *key,
+		Key:    raw,
+	})
+}
+
+// handleRevokeKey handles the revoke API key endpoint
+func (s *Server) handleRevokeKey(c *gin.Context) {
+	id := c.Param("id")
+
+	key, err := s.auth.Revoke(id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrKeyNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	s.logger.InfoContext(c.Request.Context(), "Revoked API key", "key_id", id)
+
+	key.Hash = ""
+	c.JSON(http.StatusOK, key)
+}
@@ -0,0 +1,347 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/user/subfinder-service/backend/internal/queue"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// maxBatchUpload is the maximum size of an uploaded domain list
+const maxBatchUpload = 1 << 20
+
+// maxBatchDomains is the maximum number of domains in a batch. Batches are
+// also limited to the queue capacity since all their jobs are queued at once.
+const maxBatchDomains = 1000
+
+// handleSubmitBatch handles the submit batch endpoint. Domains are accepted as a
+// JSON BatchRequest, as a newline-separated text/plain body, or as a
+// multipart/form-data upload with the list in the "file" field and an optional
+// JSON SubfinderConfig in the "config" field.
+func (s *Server) handleSubmitBatch(c *gin.Context) {
+	request, err := bindBatchRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request: %v", err),
+		})
+		return
+	}
+
+	domains := normalizeDomains(request.Domains)
+	if len(domains) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "At least one domain is required",
+		})
+		return
+	}
+
+	// Reject batches that could never be queued as a whole
+	limit := maxBatchDomains
+	if capacity := s.queue.Capacity(); capacity < limit {
+		limit = capacity
+	}
+	if len(domains) > limit {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":       fmt.Sprintf("Batch of %d domains exceeds the limit of %d domains per batch, split it into smaller batches", len(domains), limit),
+			"max_domains": limit,
+		})
+		return
+	}
+
+	// Validate the priority
+	if request.Priority == "" {
+		request.Priority = models.JobPriorityNormal
+	}
+	if !request.Priority.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid priority %q, expected high, normal or low", request.Priority),
+		})
+		return
+	}
+
+	// Set default configuration values if not provided
+	request.Config.ApplyDefaults(s.jobDefaults)
+
+	s.logger.InfoContext(c.Request.Context(), "Received batch submission", "domains", len(domains))
+
+	// Create the batch and its child jobs
+	now := time.Now()
+	batch := &models.Batch{
+		ID:        uuid.New().String(),
+		Domains:   domains,
+		Config:    request.Config,
+		JobIDs:    make([]string, 0, len(domains)),
+		CreatedAt: now,
+		Tenant:    tenant(c),
+	}
+	var keyID string
+	if key := apiKey(c); key != nil {
+		keyID = key.ID
+	}
+	jobs := make([]*models.Job, 0, len(domains))
+	for _, domain := range domains {
+		job := &models.Job{
+			ID:        uuid.New().String(),
+			Domain:    domain,
+			Config:    request.Config,
+			Status:    models.JobStatusQueued,
+			CreatedAt: now,
+			BatchID:   batch.ID,
+			APIKeyID:  keyID,
+			Tenant:    batch.Tenant,
+			Priority:  request.Priority,
+		}
+		jobs = append(jobs, job)
+		batch.JobIDs = append(batch.JobIDs, job.ID)
+	}
+
+	// Check the quota of the API key
+	release, err := s.reserve(c, len(jobs))
+	if err != nil {
+		respondReserveError(c, err)
+		return
+	}
+
+	// Enqueue all jobs at once
+	err = s.queue.EnqueueBatch(batch, jobs)
+	release(err == nil)
+	if err != nil {
+		s.logger.ErrorContext(c.Request.Context(), "Failed to enqueue batch", "batch_id", batch.ID, "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": fmt.Sprintf("Failed to enqueue batch: %v", err),
+		})
+		return
+	}
+
+	s.logger.InfoContext(c.Request.Context(), "Enqueued batch", "batch_id", batch.ID, "jobs", len(jobs))
+
+	c.JSON(http.StatusAccepted, s.batchStatus(batch))
+}
+
+// handleGetBatch handles the get batch endpoint
+func (s *Server) handleGetBatch(c *gin.Context) {
+	batch, ok := s.getBatch(c, c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Batch %s not found", c.Param("id")),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, s.batchStatus(batch))
+}
+
+// handleGetBatchResults handles the batch results endpoint, merging the
+// subdomains of all jobs of the batch and removing duplicates
+func (s *Server) handleGetBatchResults(c *gin.Context) {
+	batch, ok := s.getBatch(c, c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Batch %s not found", c.Param("id")),
+		})
+		return
+	}
+
+	status := s.batchStatus(batch)
+	seen := make(map[string]bool)
+	subdomains := make([]models.BatchSubdomain, 0)
+	for _, id := range batch.JobIDs {
+		job, ok := s.queue.Get(id)
+		if !ok {
+			continue
+		}
+		for _, info := range job.Subdomains {
+			host := strings.ToLower(info.Subdomain)
+			if seen[host] {
+				continue
+			}
+			seen[host] = true
+			subdomains = append(subdomains, models.BatchSubdomain{
+				SubdomainInfo: info,
+				Domain:        job.Domain,
+				JobID:         job.ID,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"batch_id":    batch.ID,
+		"progress":    status.Progress,
+		"total_found": len(subdomains),
+		"subdomains":  subdomains,
+	})
+}
+
+// handleDeleteBatch handles the delete batch endpoint, removing a batch and
+// all of its jobs once they have finished
+func (s *Server) handleDeleteBatch(c *gin.Context) {
+	id := c.Param("id")
+
+	// Batches of other tenants are reported as missing
+	if _, ok := s.getBatch(c, id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Batch %s not found", id),
+		})
+		return
+	}
+
+	switch err := s.queue.DeleteBatch(id); err {
+	case nil:
+	case queue.ErrBatchNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Batch %s not found", id),
+		})
+		return
+	case queue.ErrJobActive:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": fmt.Sprintf("Batch %s still has queued or running jobs, cancel them first", id),
+		})
+		return
+	default:
+		s.logger.ErrorContext(c.Request.Context(), "Failed to delete batch", "batch_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("Failed to delete batch: %v", err),
+		})
+		return
+	}
+
+	s.logger.InfoContext(c.Request.Context(), "Deleted batch", "batch_id", id)
+	c.Status(http.StatusNoContent)
+}
+
+// batchStatus collects the state of the child jobs of a batch
+func (s *Server) batchStatus(batch *models.Batch) models.BatchStatus {
+	status := models.BatchStatus{
+		Batch: *batch,
+		Jobs:  make([]models.BatchJob, 0, len(batch.JobIDs)),
+	}
+
+	// Read all child jobs at once and without their subdomains
+	jobs := make(map[string]*models.Job, len(batch.JobIDs))
+	for _, job := range s.queue.GetSummaries(batch.JobIDs) {
+		jobs[job.ID] = job
+	}
+
+	progress := &status.Progress
+	progress.Total = len(batch.JobIDs)
+	for i, id := range batch.JobIDs {
+		job, ok := jobs[id]
+		if !ok {
+			// Report deleted jobs instead of shrinking the batch
+			progress.Purged++
+			entry := models.BatchJob{JobID: id, Purged: true}
+			if i < len(batch.Domains) {
+				entry.Domain = batch.Domains[i]
+			}
+			status.Jobs = append(status.Jobs, entry)
+			continue
+		}
+		switch job.Status {
+		case models.JobStatusQueued:
+			progress.Queued++
+		case models.JobStatusRunning:
+			progress.Running++
+		case models.JobStatusCompleted:
+			progress.Completed++
+		case models.JobStatusFailed:
+			progress.Failed++
+		case models.JobStatusCanceled:
+			progress.Canceled++
+		}
+
+		entry := models.BatchJob{
+			JobID:  job.ID,
+			Domain: job.Domain,
+			Status: job.Status,
+			Error:  job.Error,
+		}
+		if job.Stats != nil {
+			entry.TotalFound = job.Stats.TotalFound
+		}
+		status.Jobs = append(status.Jobs, entry)
+	}
+
+	if progress.Total > 0 {
+		finished := progress.Completed + progress.Failed + progress.Canceled + progress.Purged
+		progress.Percent = float64(finished) * 100 / float64(progress.Total)
+		progress.Done = finished == progress.Total
+	}
+
+	return status
+}
+
+// bindBatchRequest reads a batch request in any of the supported formats
+func bindBatchRequest(c *gin.Context) (models.BatchRequest, error) {
+	var request models.BatchRequest
+
+	switch c.ContentType() {
+	case "multipart/form-data":
+		file, err := c.FormFile("file")
+		if err != nil {
+			return request, fmt.Errorf("missing domain list in file field: %v", err)
+		}
+		if file.Size > maxBatchUpload {
+			return request, fmt.Errorf("domain list exceeds %d bytes", maxBatchUpload)
+		}
+		f, err := file.Open()
+		if err != nil {
+			return request, err
+		}
+		defer f.Close()
+		if request.Domains, err = readDomainList(f); err != nil {
+			return request, err
+		}
+		request.Priority = models.JobPriority(c.PostForm("priority"))
+		if config := c.PostForm("config"); config != "" {
+			if err := json.Unmarshal([]byte(config), &request.Config); err != nil {
+				return request, fmt.Errorf("invalid config: %v", err)
+			}
+		}
+		return request, nil
+	case "text/plain":
+		domains, err := readDomainList(io.LimitReader(c.Request.Body, maxBatchUpload))
+		request.Domains = domains
+		request.Priority = models.JobPriority(c.Query("priority"))
+		return request, err
+	default:
+		err := c.ShouldBindJSON(&request)
+		return request, err
+	}
+}
+
+// readDomainList reads one domain per line, ignoring blank lines and lines starting with #
+func readDomainList(r io.Reader) ([]string, error) {
+	var domains []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+	return domains, scanner.Err()
+}
+
+// normalizeDomains trims and lower-cases domains and removes duplicates, keeping their order
+func normalizeDomains(domains []string) []string {
+	seen := make(map[string]bool, len(domains))
+	normalized := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		normalized = append(normalized, domain)
+	}
+	return normalized
+}
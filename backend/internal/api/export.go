@@ -0,0 +1,70 @@
+package api
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/subfinder-service/backend/internal/export"
+)
+
+// handleExportJob streams the subdomains of a job as a downloadable file in
+// the format given by the format query parameter (csv by default)
+func (s *Server) handleExportJob(c *gin.Context) {
+	id := c.Param("id")
+	name := strings.ToLower(c.DefaultQuery("format", "csv"))
+
+	format, ok := export.Formats[name]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Unsupported export format %q, expected csv, txt, jsonl or xlsx", name),
+		})
+		return
+	}
+
+	job, ok := s.getJob(c, id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Job %s not found", id),
+		})
+		return
+	}
+
+	s.logger.InfoContext(c.Request.Context(), "Exporting job", "job_id", id, "domain", job.Domain, "subdomains", len(job.Subdomains), "format", format.Name)
+
+	filename := fmt.Sprintf("%s-%s.%s", exportName(job.Domain), shortID(job.ID), format.Extension)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Header("Content-Type", format.ContentType)
+	c.Status(http.StatusOK)
+
+	if err := format.Write(c.Writer, job.Subdomains); err != nil {
+		// Headers are already sent, so the client only sees a truncated file
+		s.logger.ErrorContext(c.Request.Context(), "Failed to export job", "job_id", id, "error", err)
+	}
+}
+
+// exportName returns the domain reduced to characters that are safe in a file name
+func exportName(domain string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, domain)
+	if name == "" {
+		return "subdomains"
+	}
+	return name
+}
+
+// shortID returns the first block of a job ID
+func shortID(id string) string {
+	if i := strings.IndexByte(id, '-'); i > 0 {
+		return id[:i]
+	}
+	return id
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+func TestExportJob(t *testing.T) {
+	s := newTestServer(t, &models.Job{
+		ID:        "0123abcd-4567-89ef",
+		Domain:    "example.com",
+		Status:    models.JobStatusCompleted,
+		CreatedAt: time.Now(),
+		Subdomains: []models.SubdomainInfo{
+			{Subdomain: "www.example.com", IP: "192.0.2.1", Source: "crtsh", Sources: []string{"crtsh", "anubis"}},
+			{Subdomain: "=cmd.example.com", Source: "crtsh", Sources: []string{"crtsh"}},
+		},
+	})
+
+	tests := []struct {
+		name        string
+		target      string
+		status      int
+		contentType string
+		filename    string
+		body        string
+	}{
+		{
+			name:        "csv by default",
+			target:      "/subfinder/0123abcd-4567-89ef/export",
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			filename:    "example.com-0123abcd.csv",
+			body:        "subdomain,ip,source,sources\nwww.example.com,192.0.2.1,crtsh,crtsh anubis\n=cmd.example.com,,crtsh,crtsh\n",
+		},
+		{
+			name:        "txt",
+			target:      "/subfinder/0123abcd-4567-89ef/export?format=TXT",
+			status:      http.StatusOK,
+			contentType: "text/plain; charset=utf-8",
+			filename:    "example.com-0123abcd.txt",
+			body:        "www.example.com\n=cmd.example.com\n",
+		},
+		{
+			name:        "xlsx",
+			target:      "/subfinder/0123abcd-4567-89ef/export?format=xlsx",
+			status:      http.StatusOK,
+			contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+			filename:    "example.com-0123abcd.xlsx",
+		},
+		{
+			name:   "unsupported format",
+			target: "/subfinder/0123abcd-4567-89ef/export?format=pdf",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown job",
+			target: "/subfinder/missing/export",
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := get(s, test.target)
+			if recorder.Code != test.status {
+				t.Fatalf("got status %d, want %d: %s", recorder.Code, test.status, recorder.Body)
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+			if got := recorder.Header().Get("Content-Type"); got != test.contentType {
+				t.Errorf("got content type %q, want %q", got, test.contentType)
+			}
+			if got, want := recorder.Header().Get("Content-Disposition"), "attachment; filename="+test.filename; got != want {
+				t.Errorf("got disposition %q, want %q", got, want)
+			}
+			if test.body != "" && recorder.Body.String() != test.body {
+				t.Errorf("got body %q, want %q", recorder.Body, test.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// Page size limits of the job list
+const (
+	defaultJobsLimit = 50
+	maxJobsLimit     = 500
+)
+
+// jobSortFields maps the sort query parameter to the job time it sorts by
+var jobSortFields = map[string]func(job *models.Job) time.Time{
+	"created_at": func(job *models.Job) time.Time {
+		return job.CreatedAt
+	},
+	"started_at": func(job *models.Job) time.Time {
+		return timeOrZero(job.StartedAt)
+	},
+	"completed_at": func(job *models.Job) time.Time {
+		return timeOrZero(job.CompletedAt)
+	},
+}
+
+// jobQuery holds the parsed query parameters of the job list
+type jobQuery struct {
+	statuses      map[models.JobStatus]bool
+	domain        string
+	createdAfter  time.Time
+	createdBefore time.Time
+	sortBy        string
+	ascending     bool
+	limit         int
+	cursor        *jobCursor
+}
+
+// jobCursor identifies the last job of a page in the sort order
+type jobCursor struct {
+	at time.Time
+	id string
+}
+
+// handleGetAllJobs handles the get all jobs endpoint. Jobs can be filtered by
+// status, domain and creation time, sorted by one of their timestamps and are
+// returned in pages linked by an opaque cursor.
+func (s *Server) handleGetAllJobs(c *gin.Context) {
+	query, err := parseJobQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Filter the jobs and count them by status
+	counts := make(map[models.JobStatus]int)
+	matched := make([]*models.Job, 0)
+	for _, job := range s.listJobs(c) {
+		if !query.matches(job) {
+			continue
+		}
+		counts[job.Status]++
+		matched = append(matched, job)
+	}
+
+	// Sort by the requested time, using the ID to break ties
+	key := jobSortFields[query.sortBy]
+	sort.Slice(matched, func(i, j int) bool {
+		return query.before(key(matched[i]), matched[i].ID, key(matched[j]), matched[j].ID)
+	})
+
+	// Skip to the job after the cursor
+	start := 0
+	if query.cursor != nil {
+		start = sort.Search(len(matched), func(i int) bool {
+			return query.before(query.cursor.at, query.cursor.id, key(matched[i]), matched[i].ID)
+		})
+	}
+	end := start + query.limit
+	if end > len(matched) {
+		end = len(matched)
+	}
+	page := matched[start:end]
+
+	s.logger.DebugContext(c.Request.Context(), "Listing jobs", "listed", len(page), "matched", len(matched))
+
+	// Create a simplified job list for the response
+	jobList := make([]models.JobSummary, 0, len(page))
+	for _, job := range page {
+		jobList = append(jobList, models.JobSummary{
+			JobID:       job.ID,
+			Domain:      job.Domain,
+			Status:      job.Status,
+			CreatedAt:   job.CreatedAt,
+			StartedAt:   job.StartedAt,
+			CompletedAt: job.CompletedAt,
+		})
+	}
+
+	response := gin.H{
+		"jobs":  jobList,
+		"total": len(matched),
+		"counts": gin.H{
+			"queued":    counts[models.JobStatusQueued],
+			"running":   counts[models.JobStatusRunning],
+			"completed": counts[models.JobStatusCompleted],
+			"failed":    counts[models.JobStatusFailed],
+			"canceled":  counts[models.JobStatusCanceled],
+		},
+	}
+	if end < len(matched) {
+		last := matched[end-1]
+		response["next_cursor"] = encodeJobCursor(jobCursor{at: key(last), id: last.ID})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// parseJobQuery reads the filter, sort and paging parameters of the job list
+func parseJobQuery(c *gin.Context) (*jobQuery, error) {
+	query := &jobQuery{
+		sortBy: c.DefaultQuery("sort", "created_at"),
+		domain: strings.ToLower(strings.TrimSpace(c.Query("domain"))),
+		limit:  defaultJobsLimit,
+	}
+
+	if _, ok := jobSortFields[query.sortBy]; !ok {
+		return nil, fmt.Errorf("invalid sort %q, expected created_at, started_at or completed_at", query.sortBy)
+	}
+
+	switch order := c.DefaultQuery("order", "desc"); order {
+	case "desc":
+	case "asc":
+		query.ascending = true
+	default:
+		return nil, fmt.Errorf("invalid order %q, expected asc or desc", order)
+	}
+
+	if value := c.Query("status"); value != "" {
+		query.statuses = make(map[models.JobStatus]bool)
+		for _, status := range strings.Split(value, ",") {
+			status := models.JobStatus(strings.TrimSpace(status))
+			switch status {
+			case models.JobStatusQueued, models.JobStatusRunning, models.JobStatusCompleted, models.JobStatusFailed, models.JobStatusCanceled:
+				query.statuses[status] = true
+			default:
+				return nil, fmt.Errorf("invalid status %q", status)
+			}
+		}
+	}
+
+	if query.domain != "" {
+		if _, err := path.Match(query.domain, ""); err != nil {
+			return nil, fmt.Errorf("invalid domain pattern %q", query.domain)
+		}
+	}
+
+	var err error
+	if query.createdAfter, err = parseTimeParam(c, "created_after"); err != nil {
+		return nil, err
+	}
+	if query.createdBefore, err = parseTimeParam(c, "created_before"); err != nil {
+		return nil, err
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxJobsLimit {
+			return nil, fmt.Errorf("invalid limit %q, expected 1 to %d", value, maxJobsLimit)
+		}
+		query.limit = limit
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodeJobCursor(value)
+		if err != nil {
+			return nil, err
+		}
+		query.cursor = &cursor
+	}
+
+	return query, nil
+}
+
+// parseTimeParam parses an optional RFC 3339 query parameter
+func parseTimeParam(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q, expected an RFC 3339 time", name, value)
+	}
+	return t, nil
+}
+
+// matches reports whether a job passes the filters of the query
+func (q *jobQuery) matches(job *models.Job) bool {
+	if q.statuses != nil && !q.statuses[job.Status] {
+		return false
+	}
+	if q.domain != "" && !matchDomain(q.domain, job.Domain) {
+		return false
+	}
+	if !q.createdAfter.IsZero() && job.CreatedAt.Before(q.createdAfter) {
+		return false
+	}
+	if !q.createdBefore.IsZero() && !job.CreatedAt.Before(q.createdBefore) {
+		return false
+	}
+	return true
+}
+
+// before reports whether the job at (a, aID) comes before the job at (b, bID) in the sort order
+func (q *jobQuery) before(a time.Time, aID string, b time.Time, bID string) bool {
+	if !a.Equal(b) {
+		return a.Before(b) == q.ascending
+	}
+	if aID == bID {
+		return false
+	}
+	return (aID < bID) == q.ascending
+}
+
+// matchDomain matches a domain against a lower-case pattern where * matches
+// any characters, including dots, and ? matches a single character. Domains
+// never contain the / that would stop path.Match at a *.
+func matchDomain(pattern, domain string) bool {
+	matched, _ := path.Match(pattern, strings.ToLower(domain))
+	return matched
+}
+
+// encodeJobCursor encodes a cursor as an opaque string. Jobs without the
+// sorted time have the zero time, which is encoded as an empty string.
+func encodeJobCursor(cursor jobCursor) string {
+	var at string
+	if !cursor.at.IsZero() {
+		at = strconv.FormatInt(cursor.at.UnixNano(), 10)
+	}
+	raw := at + "|" + cursor.id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeJobCursor decodes a cursor returned by encodeJobCursor
+func decodeJobCursor(value string) (jobCursor, error) {
+	invalid := errors.New("invalid cursor")
+
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return jobCursor{}, invalid
+	}
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return jobCursor{}, invalid
+	}
+	if at == "" {
+		return jobCursor{id: id}, nil
+	}
+	nanos, err := strconv.ParseInt(at, 10, 64)
+	if err != nil {
+		return jobCursor{}, invalid
+	}
+	return jobCursor{at: time.Unix(0, nanos), id: id}, nil
+}
+
+// timeOrZero returns the time t points to, or the zero time
+func timeOrZero(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// jobList is the response of the job list
+type jobList struct {
+	Jobs       []models.JobSummary `json:"jobs"`
+	Total      int                 `json:"total"`
+	Counts     map[string]int      `json:"counts"`
+	NextCursor string              `json:"next_cursor"`
+}
+
+// listedJobs returns the IDs of all jobs listed for query, following the cursors
+// with pages of limit jobs
+func listedJobs(t *testing.T, s *Server, query url.Values, limit int) ([]string, jobList) {
+	t.Helper()
+	query.Set("limit", fmt.Sprint(limit))
+
+	var ids []string
+	var first jobList
+	for page := 0; ; page++ {
+		var list jobList
+		decode(t, get(s, "/subfinder/jobs?"+query.Encode()), &list)
+		if page == 0 {
+			first = list
+		}
+		if len(list.Jobs) > limit {
+			t.Fatalf("got %d jobs on a page of %d", len(list.Jobs), limit)
+		}
+		for _, job := range list.Jobs {
+			ids = append(ids, job.JobID)
+		}
+		if list.NextCursor == "" {
+			return ids, first
+		}
+		if page > 10 {
+			t.Fatal("cursors do not end")
+		}
+		query.Set("cursor", list.NextCursor)
+	}
+}
+
+func TestListJobsPagesThroughCursors(t *testing.T) {
+	base := time.Date(2025, 4, 4, 12, 0, 0, 0, time.UTC)
+	job := func(id, domain string, status models.JobStatus, minute int, started bool) *models.Job {
+		j := &models.Job{ID: id, Domain: domain, Status: status, CreatedAt: base.Add(time.Duration(minute) * time.Minute)}
+		if started {
+			at := j.CreatedAt.Add(time.Second)
+			j.StartedAt = &at
+		}
+		return j
+	}
+	s := newTestServer(t,
+		job("a", "example.com", models.JobStatusCompleted, 1, true),
+		job("b", "www.example.com", models.JobStatusFailed, 2, true),
+		// c and d were created at the same time and are ordered by ID
+		job("c", "example.org", models.JobStatusCompleted, 3, true),
+		job("d", "example.com", models.JobStatusRunning, 3, true),
+		job("e", "EXAMPLE.com", models.JobStatusQueued, 4, false),
+	)
+
+	tests := []struct {
+		name   string
+		query  url.Values
+		limit  int
+		want   []string
+		counts map[string]int
+	}{
+		{
+			name:  "newest first",
+			query: url.Values{},
+			limit: 2,
+			want:  []string{"e", "d", "c", "b", "a"},
+		},
+		{
+			name:  "oldest first",
+			query: url.Values{"order": {"asc"}},
+			limit: 2,
+			want:  []string{"a", "b", "c", "d", "e"},
+		},
+		{
+			name:  "single page",
+			query: url.Values{"order": {"asc"}},
+			limit: 5,
+			want:  []string{"a", "b", "c", "d", "e"},
+		},
+		{
+			name:  "jobs that have not started come first by ascending start time",
+			query: url.Values{"sort": {"started_at"}, "order": {"asc"}},
+			limit: 1,
+			want:  []string{"e", "a", "b", "c", "d"},
+		},
+		{
+			name:   "status and domain filters",
+			query:  url.Values{"status": {"completed,queued,running"}, "domain": {"example.com"}},
+			limit:  1,
+			want:   []string{"e", "d", "a"},
+			counts: map[string]int{"queued": 1, "running": 1, "completed": 1, "failed": 0, "canceled": 0},
+		},
+		{
+			name:  "domain pattern",
+			query: url.Values{"domain": {"*.example.com"}},
+			limit: 2,
+			want:  []string{"b"},
+		},
+		{
+			name:  "creation time range",
+			query: url.Values{"created_after": {"2025-04-04T12:02:00Z"}, "created_before": {"2025-04-04T12:04:00Z"}},
+			limit: 1,
+			want:  []string{"d", "c", "b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, first := listedJobs(t, s, test.query, test.limit)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got jobs %v, want %v", got, test.want)
+			}
+			if first.Total != len(test.want) {
+				t.Errorf("got total %d, want %d", first.Total, len(test.want))
+			}
+			if test.counts != nil && !reflect.DeepEqual(first.Counts, test.counts) {
+				t.Errorf("got counts %v, want %v", first.Counts, test.counts)
+			}
+		})
+	}
+}
+
+func TestListJobsRejectsInvalidQueries(t *testing.T) {
+	s := newTestServer(t)
+	for _, query := range []string{
+		"sort=domain",
+		"order=up",
+		"status=done",
+		"limit=0",
+		"limit=501",
+		"created_after=yesterday",
+		"cursor=not-a-cursor",
+		"domain=[",
+	} {
+		if recorder := get(s, "/subfinder/jobs?"+query); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want 400", query, recorder.Code)
+		}
+	}
+}
+
+func TestStatusCountsJobsWithoutListingThem(t *testing.T) {
+	s := newTestServer(t,
+		&models.Job{ID: "a", Domain: "example.com", Status: models.JobStatusCompleted, CreatedAt: time.Now()},
+		&models.Job{ID: "b", Domain: "example.com", Status: models.JobStatusCompleted, CreatedAt: time.Now()},
+		&models.Job{ID: "c", Domain: "example.com", Status: models.JobStatusFailed, CreatedAt: time.Now()},
+		&models.Job{ID: "d", Domain: "example.com", Status: models.JobStatusQueued, CreatedAt: time.Now()},
+	)
+
+	var status map[string]any
+	decode(t, get(s, "/subfinder/status"), &status)
+
+	if status["status"] != "ok" {
+		t.Errorf("got status %v", status["status"])
+	}
+	if _, err := time.Parse(time.RFC3339, fmt.Sprint(status["time"])); err != nil {
+		t.Errorf("got time %v", status["time"])
+	}
+	want := map[string]any{"total": 4.0, "queued": 1.0, "running": 0.0, "completed": 2.0, "failed": 1.0, "canceled": 0.0}
+	if !reflect.DeepEqual(status["jobs"], want) {
+		t.Errorf("got jobs %v, want %v", status["jobs"], want)
+	}
+	if len(status) != 3 {
+		t.Errorf("got fields %v, want only status, jobs and time", status)
+	}
+}
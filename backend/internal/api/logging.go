@@ -0,0 +1,47 @@
+package api
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/user/subfinder-service/backend/internal/logging"
+)
+
+// RequestIDHeader carries the ID of a request. An ID sent by the client is
+// kept; otherwise one is generated. The ID is returned in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestID is the longest request ID accepted from a client
+const maxRequestID = 128
+
+// logRequests tags the logs of each request with its request ID and logs the
+// request when it ends. Probes of /health and scrapes of /metrics are logged
+// at debug level only.
+func logRequests(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > maxRequestID {
+			id = uuid.New().String()
+		}
+		c.Header(RequestIDHeader, id)
+		ctx := logging.With(c.Request.Context(), "request_id", id)
+		c.Request = c.Request.WithContext(ctx)
+
+		start := time.Now()
+		c.Next()
+
+		level := slog.LevelInfo
+		if untracedPaths[c.Request.URL.Path] {
+			level = slog.LevelDebug
+		}
+		logger.Log(ctx, level, "Handled request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"duration", time.Since(start),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/subfinder-service/backend/internal/providers"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// handleListProviders handles the list provider keys endpoint
+func (s *Server) handleListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"providers": s.providers.List(),
+	})
+}
+
+// handleAddProviderKey handles the add provider key endpoint
+func (s *Server) handleAddProviderKey(c *gin.Context) {
+	source := c.Param("source")
+
+	var request models.ProviderKeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request: %v", err),
+		})
+		return
+	}
+
+	key, err := s.providers.Add(source, request.Key)
+	if err != nil {
+		s.respondProviderError(c, err)
+		return
+	}
+
+	s.logger.InfoContext(c.Request.Context(), "Added provider key", "key_id", key.ID, "source", key.Source)
+	c.JSON(http.StatusCreated, key)
+}
+
+// handleRotateProviderKey handles the rotate provider key endpoint
+func (s *Server) handleRotateProviderKey(c *gin.Context) {
+	source := c.Param("source")
+	id := c.Param("id")
+
+	var request models.ProviderKeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request: %v", err),
+		})
+		return
+	}
+
+	key, err := s.providers.Rotate(source, id, request.Key)
+	if err != nil {
+		s.respondProviderError(c, err)
+		return
+	}
+
+	s.logger.InfoContext(c.Request.Context(), "Rotated provider key", "key_id", id, "source", key.Source)
+	c.JSON(http.StatusOK, key)
+}
+
+// handleDeleteProviderKey handles the delete provider key endpoint
+func (s *Server) handleDeleteProviderKey(c *gin.Context) {
+	source := c.Param("source")
+	id := c.Param("id")
+
+	if err := s.providers.Delete(source, id); err != nil {
+		s.respondProviderError(c, err)
+		return
+	}
+
+	s.logger.InfoContext(c.Request.Context(), "Deleted provider key", "key_id", id, "source", source)
+	c.Status(http.StatusNoContent)
+}
+
+// respondProviderError maps provider key errors to HTTP responses
+func (s *Server) respondProviderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, providers.ErrKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+	case errors.Is(err, providers.ErrUnknownSource), errors.Is(err, providers.ErrInvalidKey):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		s.logger.ErrorContext(c.Request.Context(), "Provider key operation failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("Provider key operation failed: %v", err),
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/subfinder-service/backend/internal/scheduler"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// handleListSchedules handles the list schedules endpoint
+func (s *Server) handleListSchedules(c *gin.Context) {
+	schedules := make([]*models.Schedule, 0)
+	for _, schedule := range s.scheduler.List() {
+		if s.owns(c, schedule.Tenant) {
+			schedules = append(schedules, schedule)
+		}
+	}
+
+	s.logger.DebugContext(c.Request.Context(), "Listing schedules", "schedules", len(schedules))
+
+	c.JSON(http.StatusOK, gin.H{
+		"schedules": schedules,
+	})
+}
+
+// handleCreateSchedule handles the create schedule endpoint
+func (s *Server) handleCreateSchedule(c *gin.Context) {
+	var request models.ScheduleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request: %v", err),
+		})
+		return
+	}
+
+	var keyID string
+	if key := apiKey(c); key != nil {
+		keyID = key.ID
+	}
+	schedule, err := s.scheduler.Create(request, tenant(c), keyID)
+	if err != nil {
+		s.respondScheduleError(c, "", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// handleGetSchedule handles the get schedule endpoint
+func (s *Server) handleGetSchedule(c *gin.Context) {
+	id := c.Param("id")
+
+	schedule, ok := s.getSchedule(c, id)
+	if !ok {
+		s.respondScheduleError(c, id, scheduler.ErrScheduleNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// handleUpdateSchedule handles the update schedule endpoint
+func (s *Server) handleUpdateSchedule(c *gin.Context) {
+	id := c.Param("id")
+
+	var request models.ScheduleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid request: %v", err),
+		})
+		return
+	}
+
+	if _, ok := s.getSchedule(c, id); !ok {
+		s.respondScheduleError(c, id, scheduler.ErrScheduleNotFound)
+		return
+	}
+
+	schedule, err := s.scheduler.Update(id, request)
+	if err != nil {
+		s.respondScheduleError(c, id, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// handleDeleteSchedule handles the delete schedule endpoint
+func (s *Server) handleDeleteSchedule(c *gin.Context) {
+	id := c.Param("id")
+
+	if _, ok := s.getSchedule(c, id); !ok {
+		s.respondScheduleError(c, id, scheduler.ErrScheduleNotFound)
+		return
+	}
+
+	if err := s.scheduler.Delete(id); err != nil {
+		s.respondScheduleError(c, id, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// respondScheduleError maps scheduler errors to HTTP responses
+func (s *Server) respondScheduleError(c *gin.Context, id string, err error) {
+	switch {
+	case errors.Is(err, scheduler.ErrScheduleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Schedule %s not found", id),
+		})
+	case errors.Is(err, scheduler.ErrInvalidSchedule):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		s.logger.ErrorContext(c.Request.Context(), "Schedule operation failed", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("Schedule operation failed: %v", err),
+		})
+	}
+}
@@ -3,34 +3,64 @@ package api
 import (
 	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/user/subfinder-service/backend/internal/auth"
+	"github.com/user/subfinder-service/backend/internal/diff"
+	"github.com/user/subfinder-service/backend/internal/providers"
 	"github.com/user/subfinder-service/backend/internal/queue"
+	"github.com/user/subfinder-service/backend/internal/scheduler"
+	"github.com/user/subfinder-service/backend/internal/tracing"
+	"github.com/user/subfinder-service/backend/internal/webhook"
 	"github.com/user/subfinder-service/backend/pkg/models"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Server represents the API server
 type Server struct {
-	port   string
-	router *gin.Engine
-	queue  *queue.JobQueue
-	logger *log.Logger
-	server *http.Server
+	port      string
+	router    *gin.Engine
+	queue     *queue.JobQueue
+	scheduler *scheduler.Scheduler
+	auth      *auth.Manager
+	providers *providers.Manager
+	logger    *slog.Logger
+	server    *http.Server
+
+	// Bearer token required by the /admin endpoints
+	adminToken string
+
+	// Options applied to submitted jobs that do not set them
+	jobDefaults models.SubfinderConfig
 }
 
-// NewServer creates a new API server
-func NewServer(port string, queue *queue.JobQueue, logger *log.Logger) *Server {
-	router := gin.Default()
+// NewServer creates a new API server. Requests to the API require an API key
+// unless keys is nil. Provider keys can only be managed if providerKeys is not nil.
+// Both kinds of keys are managed with adminToken; without it the admin endpoints
+// reject every request. Options that a submitted job does not set are taken
+// from jobDefaults.
+func NewServer(port string, queue *queue.JobQueue, scheduler *scheduler.Scheduler, keys *auth.Manager, providerKeys *providers.Manager, adminToken string, jobDefaults models.SubfinderConfig, logger *slog.Logger) *Server {
+	// Keep gin's debug output out of the structured logs unless GIN_MODE asks for it
+	if _, ok := os.LookupEnv(gin.EnvGinMode); !ok {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	router := gin.New()
+	router.Use(gin.Recovery())
 
 	// Add CORS middleware
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, X-Request-ID, traceparent, tracestate")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", RequestIDHeader)
 
 		// Handle preflight requests
 		if c.Request.Method == "OPTIONS" {
@@ -41,11 +71,22 @@ func NewServer(port string, queue *queue.JobQueue, logger *log.Logger) *Server {
 		c.Next()
 	})
 
+	// Trace requests, continuing the trace of the caller
+	router.Use(traceRequests)
+
+	// Tag the logs of each request with its ID and log the request when it ends
+	router.Use(logRequests(logger))
+
 	server := &Server{
-		port:   port,
-		router: router,
-		queue:  queue,
-		logger: logger,
+		port:        port,
+		router:      router,
+		queue:       queue,
+		scheduler:   scheduler,
+		auth:        keys,
+		providers:   providerKeys,
+		logger:      logger,
+		adminToken:  adminToken,
+		jobDefaults: jobDefaults,
 	}
 
 	// Set up routes
@@ -59,8 +100,33 @@ func (s *Server) setupRoutes() {
 	// Health check endpoint
 	s.router.GET("/health", s.handleHealthCheck)
 
+	// Prometheus metrics endpoint, left open like the health check for scrapers
+	s.router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
 	// API endpoints
 	api := s.router.Group("/subfinder")
+	if s.auth != nil {
+		api.Use(s.requireAPIKey)
+
+		// Manage API keys
+		keys := s.router.Group("/admin/keys", s.requireAdmin)
+		{
+			keys.GET("", s.handleListKeys)
+			keys.POST("", s.handleCreateKey)
+			keys.DELETE("/:id", s.handleRevokeKey)
+		}
+	}
+
+	// Manage API keys of the passive sources, whether or not authentication is enabled
+	if s.providers != nil {
+		providers := s.router.Group("/admin/providers", s.requireAdmin)
+		{
+			providers.GET("", s.handleListProviders)
+			providers.POST("/:source/keys", s.handleAddProviderKey)
+			providers.PUT("/:source/keys/:id", s.handleRotateProviderKey)
+			providers.DELETE("/:source/keys/:id", s.handleDeleteProviderKey)
+		}
+	}
 	{
 		// Submit a new job
 		api.POST("", s.handleSubmitJob)
@@ -68,11 +134,48 @@ func (s *Server) setupRoutes() {
 		// Get job status/results
 		api.GET("/:id", s.handleGetJob)
 
+		// Delete a finished job
+		api.DELETE("/:id", s.handleDeleteJob)
+
+		// Stream live results as Server-Sent Events
+		api.GET("/:id/stream", s.handleStreamJob)
+
+		// Cancel a queued or running job
+		api.POST("/:id/cancel", s.handleCancelJob)
+
+		// List the subdomains of a job page by page
+		api.GET("/:id/subdomains", s.handleGetSubdomains)
+
+		// Download the results as csv, txt, jsonl or xlsx
+		api.GET("/:id/export", s.handleExportJob)
+
 		// Get service status
 		api.GET("/status", s.handleGetStatus)
 
 		// Get all jobs
 		api.GET("/jobs", s.handleGetAllJobs)
+
+		// Compare the results of two jobs
+		api.GET("/diff", s.handleDiffJobs)
+
+		// Submit many domains at once and track them together
+		batches := api.Group("/batches")
+		{
+			batches.POST("", s.handleSubmitBatch)
+			batches.GET("/:id", s.handleGetBatch)
+			batches.GET("/:id/results", s.handleGetBatchResults)
+			batches.DELETE("/:id", s.handleDeleteBatch)
+		}
+
+		// Manage recurring scans
+		schedules := api.Group("/schedules")
+		{
+			schedules.GET("", s.handleListSchedules)
+			schedules.POST("", s.handleCreateSchedule)
+			schedules.GET("/:id", s.handleGetSchedule)
+			schedules.PUT("/:id", s.handleUpdateSchedule)
+			schedules.DELETE("/:id", s.handleDeleteSchedule)
+		}
 	}
 }
 
@@ -83,7 +186,7 @@ func (s *Server) Start() error {
 		Handler: s.router,
 	}
 
-	s.logger.Printf("Starting API server on port %s", s.port)
+	s.logger.Info("Starting API server", "port", s.port)
 	return s.server.ListenAndServe()
 }
 
@@ -118,19 +221,35 @@ func (s *Server) handleSubmitJob(c *gin.Context) {
 		return
 	}
 
-	// Set default configuration values if not provided
-	if request.Config.MaxDepth <= 0 {
-		request.Config.MaxDepth = 1
+	// Validate the callback URL
+	if request.CallbackURL != "" {
+		if err := webhook.ValidateURL(request.CallbackURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 	}
-	if request.Config.Timeout <= 0 {
-		request.Config.Timeout = 60
+
+	// Validate the priority
+	if request.Priority == "" {
+		request.Priority = models.JobPriorityNormal
 	}
-	if request.Config.RateLimit <= 0 {
-		request.Config.RateLimit = 10
+	if !request.Priority.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid priority %q, expected high, normal or low", request.Priority),
+		})
+		return
 	}
-	// ExcludeWww is false by default, so no need to set it explicitly
 
-	s.logger.Printf("Received job submission for domain %s", request.Domain)
+	// Set default configuration values if not provided
+	request.Config.ApplyDefaults(s.jobDefaults)
+
+	s.logger.InfoContext(c.Request.Context(), "Received job submission", "domain", request.Domain)
+
+	// Start the trace the job carries from submission to completion
+	ctx, span := tracing.Tracer().Start(c.Request.Context(), "submit job")
+	defer span.End()
 
 	// Create a new job
 	job := &models.Job{
@@ -139,24 +258,54 @@ func (s *Server) handleSubmitJob(c *gin.Context) {
 		Config:    request.Config,
 		Status:    models.JobStatusQueued,
 		CreatedAt: time.Now(),
+		Priority:  request.Priority,
+		TraceID:   span.SpanContext().TraceID().String(),
+	}
+	job.TraceContext = tracing.Inject(ctx)
+	span.SetAttributes(
+		attribute.String("job.id", job.ID),
+		attribute.String("job.domain", job.Domain),
+		attribute.String("job.priority", string(job.Priority)),
+	)
+	if request.CallbackURL != "" {
+		job.Webhook = &models.Webhook{
+			URL:    request.CallbackURL,
+			Secret: request.CallbackSecret,
+		}
+	}
+	if key := apiKey(c); key != nil {
+		job.APIKeyID = key.ID
+		job.Tenant = key.Tenant
+	}
+
+	// Check the quota of the API key
+	release, err := s.reserve(c, 1)
+	if err != nil {
+		tracing.Fail(span, err)
+		respondReserveError(c, err)
+		return
 	}
 
 	// Enqueue the job
-	if err := s.queue.Enqueue(job); err != nil {
-		s.logger.Printf("Failed to enqueue job %s: %v", job.ID, err)
+	err = s.queue.Enqueue(job)
+	release(err == nil)
+	if err != nil {
+		s.logger.ErrorContext(c.Request.Context(), "Failed to enqueue job", "job_id", job.ID, "domain", job.Domain, "error", err)
+		tracing.Fail(span, err)
 		c.JSON(http.StatusServiceUnavailable, gin.H{
 			"error": fmt.Sprintf("Failed to enqueue job: %v", err),
 		})
 		return
 	}
 
-	s.logger.Printf("Enqueued job %s for domain %s", job.ID, job.Domain)
+	s.logger.InfoContext(c.Request.Context(), "Enqueued job", "job_id", job.ID, "domain", job.Domain)
 
 	// Return the job ID and status
 	c.JSON(http.StatusAccepted, models.JobResponse{
 		JobID:                   job.ID,
 		Status:                  job.Status,
 		EstimatedCompletionTime: job.EstimatedCompletionTime,
+		TraceID:                 job.TraceID,
 	})
 }
 
@@ -170,10 +319,16 @@ func (s *Server) handleGetJob(c *gin.Context) {
 		return
 	}
 
-	s.logger.Printf("Retrieving job %s", id)
+	omit, err := parseOmit(c.Query("omit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
 	// Get the job from the queue
-	job, ok := s.queue.Get(id)
+	job, ok := s.getJob(c, id)
 	if !ok {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": fmt.Sprintf("Job %s not found", id),
@@ -181,27 +336,274 @@ func (s *Server) handleGetJob(c *gin.Context) {
 		return
 	}
 
-	s.logger.Printf("Job %s status %s", id, job.Status)
+	s.logger.DebugContext(c.Request.Context(), "Retrieved job", "job_id", id, "domain", job.Domain, "status", job.Status)
+
+	// Show where a queued job waits
+	job = redactJob(job)
+	if info, ok := s.queue.Position(id); ok {
+		withQueue := *job
+		withQueue.Queue = info
+		job = &withQueue
+	}
+
+	// Leave out the parts the client does not need
+	if len(omit) > 0 {
+		trimmed := *job
+		if omit["subdomains"] {
+			trimmed.Subdomains = nil
+		}
+		if omit["log"] {
+			trimmed.Log = nil
+		}
+		if omit["diff"] {
+			trimmed.Diff = nil
+		}
+		job = &trimmed
+	}
 
 	// Return the job
 	c.JSON(http.StatusOK, job)
 }
 
+// parseOmit parses the comma-separated job fields to leave out of a response
+func parseOmit(value string) (map[string]bool, error) {
+	omit := make(map[string]bool)
+	if value == "" {
+		return omit, nil
+	}
+	for _, field := range strings.Split(value, ",") {
+		switch field = strings.TrimSpace(field); field {
+		case "subdomains", "log", "diff":
+			omit[field] = true
+		default:
+			return nil, fmt.Errorf("invalid omit %q, expected subdomains, log or diff", field)
+		}
+	}
+	return omit, nil
+}
+
+// redactJob returns a copy of the job without the webhook secret
+func redactJob(job *models.Job) *models.Job {
+	if job.Webhook == nil || job.Webhook.Secret == "" {
+		return job
+	}
+	redacted := *job
+	webhook := *job.Webhook
+	webhook.Secret = ""
+	redacted.Webhook = &webhook
+	return &redacted
+}
+
+// streamHeartbeat is the interval between keep-alive events on idle streams
+const streamHeartbeat = 15 * time.Second
+
+// handleStreamJob streams subdomains and status changes of a job as Server-Sent Events.
+// Results found before the client connected are replayed first, and results
+// not stored yet at that time are sent before the final status. The stream
+// ends once the job reaches a final status, or with a resync event if the
+// client fell too far behind, after which it should reconnect to get the
+// results and status it missed replayed.
+func (s *Server) handleStreamJob(c *gin.Context) {
+	id := c.Param("id")
+
+	// Subscribe before reading the job so no result falls between the snapshot and the live events
+	events, unsubscribe := s.queue.Subscribe(id)
+	defer unsubscribe()
+
+	job, ok := s.getJob(c, id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Job %s not found", id),
+		})
+		return
+	}
+
+	s.logger.InfoContext(c.Request.Context(), "Streaming job", "job_id", id, "domain", job.Domain)
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	// Replay the results found so far
+	seen := make(map[string]bool, len(job.Subdomains))
+	for _, info := range job.Subdomains {
+		seen[info.Subdomain] = true
+		c.SSEvent(queue.EventSubdomain, info)
+	}
+	c.SSEvent(queue.EventStatus, gin.H{"status": job.Status})
+	c.Writer.Flush()
+
+	if job.Status.IsFinal() {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-heartbeat.C:
+			c.SSEvent("heartbeat", gin.H{"time": time.Now().Format(time.RFC3339)})
+			return true
+		case event, ok := <-events:
+			if !ok {
+				s.logger.WarnContext(c.Request.Context(), "Stream fell behind, asking the client to resync", "job_id", id)
+				c.SSEvent("resync", gin.H{"reason": "too many events were pending, reconnect to resume"})
+				return false
+			}
+			switch event.Type {
+			case queue.EventSubdomain:
+				if !seen[event.Subdomain.Subdomain] {
+					seen[event.Subdomain.Subdomain] = true
+					c.SSEvent(queue.EventSubdomain, event.Subdomain)
+				}
+			case queue.EventStatus:
+				if event.Status.IsFinal() {
+					// Results found before the client subscribed may have been
+					// stored only with the final results
+					if job, ok := s.queue.Get(id); ok {
+						for _, info := range job.Subdomains {
+							if !seen[info.Subdomain] {
+								seen[info.Subdomain] = true
+								c.SSEvent(queue.EventSubdomain, info)
+							}
+						}
+					}
+				}
+				c.SSEvent(queue.EventStatus, gin.H{"status": event.Status})
+				return !event.Status.IsFinal()
+			}
+			return true
+		}
+	})
+}
+
+// handleCancelJob handles the cancel job endpoint
+func (s *Server) handleCancelJob(c *gin.Context) {
+	id := c.Param("id")
+
+	s.logger.InfoContext(c.Request.Context(), "Canceling job", "job_id", id)
+
+	// Jobs of other tenants are reported as missing
+	if _, ok := s.getJob(c, id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Job %s not found", id),
+		})
+		return
+	}
+
+	job, err := s.queue.Cancel(id)
+	switch err {
+	case nil:
+	case queue.ErrJobNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Job %s not found", id),
+		})
+		return
+	case queue.ErrJobFinished:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": fmt.Sprintf("Job %s has already finished", id),
+		})
+		return
+	default:
+		s.logger.ErrorContext(c.Request.Context(), "Failed to cancel job", "job_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("Failed to cancel job: %v", err),
+		})
+		return
+	}
+
+	// Running jobs keep their status until the worker has stopped subfinder
+	c.JSON(http.StatusAccepted, models.JobResponse{
+		JobID:  job.ID,
+		Status: job.Status,
+	})
+}
+
+// handleDeleteJob handles the delete job endpoint
+func (s *Server) handleDeleteJob(c *gin.Context) {
+	id := c.Param("id")
+
+	// Jobs of other tenants are reported as missing
+	if _, ok := s.getJob(c, id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Job %s not found", id),
+		})
+		return
+	}
+
+	switch err := s.queue.Delete(id); err {
+	case nil:
+	case queue.ErrJobNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Job %s not found", id),
+		})
+		return
+	case queue.ErrJobActive:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": fmt.Sprintf("Job %s is still queued or running, cancel it first", id),
+		})
+		return
+	default:
+		s.logger.ErrorContext(c.Request.Context(), "Failed to delete job", "job_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("Failed to delete job: %v", err),
+		})
+		return
+	}
+
+	s.logger.InfoContext(c.Request.Context(), "Deleted job", "job_id", id)
+	c.Status(http.StatusNoContent)
+}
+
+// handleDiffJobs handles the diff endpoint, comparing the results of the
+// "from" job with those of the "to" job
+func (s *Server) handleDiffJobs(c *gin.Context) {
+	fromID := c.Query("from")
+	toID := c.Query("to")
+	if fromID == "" || toID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Both from and to job IDs are required",
+		})
+		return
+	}
+
+	jobs := make([]*models.Job, 0, 2)
+	for _, id := range []string{fromID, toID} {
+		job, ok := s.getJob(c, id)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": fmt.Sprintf("Job %s not found", id),
+			})
+			return
+		}
+		if job.Status != models.JobStatusCompleted {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": fmt.Sprintf("Job %s has status %s, only completed jobs can be compared", id, job.Status),
+			})
+			return
+		}
+		jobs = append(jobs, job)
+	}
+
+	s.logger.DebugContext(c.Request.Context(), "Comparing jobs", "from_job_id", fromID, "to_job_id", toID)
+
+	c.JSON(http.StatusOK, diff.Compare(jobs[0], jobs[1]))
+}
+
 // handleGetStatus handles the get status endpoint
 func (s *Server) handleGetStatus(c *gin.Context) {
-	// Get all jobs
-	jobs := s.queue.List()
+	jobs := s.listJobs(c)
 
-	s.logger.Printf("Reporting status for %d job(s)", len(jobs))
+	s.logger.DebugContext(c.Request.Context(), "Reporting status", "jobs", len(jobs))
 
-	// Count jobs by status
+	// Count jobs by status. Jobs themselves are listed page by page by /subfinder/jobs.
 	queued := 0
 	running := 0
 	completed := 0
 	failed := 0
-
-	// Create a simplified job list for the response
-	jobList := make([]gin.H, 0, len(jobs))
+	canceled := 0
 	for _, job := range jobs {
 		switch job.Status {
 		case models.JobStatusQueued:
@@ -212,18 +614,11 @@ func (s *Server) handleGetStatus(c *gin.Context) {
 			completed++
 		case models.JobStatusFailed:
 			failed++
+		case models.JobStatusCanceled:
+			canceled++
 		}
-
-		// Add job to the list
-		jobList = append(jobList, gin.H{
-			"job_id":     job.ID,
-			"domain":     job.Domain,
-			"status":     job.Status,
-			"created_at": job.CreatedAt,
-		})
 	}
 
-	// Return the status and job list
 	c.JSON(http.StatusOK, gin.H{
 		"status": "ok",
 		"jobs": gin.H{
@@ -232,32 +627,8 @@ func (s *Server) handleGetStatus(c *gin.Context) {
 			"running":   running,
 			"completed": completed,
 			"failed":    failed,
-			"list":      jobList,
+			"canceled":  canceled,
 		},
 		"time": time.Now().Format(time.RFC3339),
 	})
 }
-
-// handleGetAllJobs handles the get all jobs endpoint
-func (s *Server) handleGetAllJobs(c *gin.Context) {
-	// Get all jobs
-	jobs := s.queue.List()
-
-	s.logger.Printf("Listing %d job(s)", len(jobs))
-
-	// Create a simplified job list for the response
-	jobList := make([]gin.H, 0, len(jobs))
-	for _, job := range jobs {
-		jobList = append(jobList, gin.H{
-			"job_id":     job.ID,
-			"domain":     job.Domain,
-			"status":     job.Status,
-			"created_at": job.CreatedAt,
-		})
-	}
-
-	// Return the job list
-	c.JSON(http.StatusOK, gin.H{
-		"jobs": jobList,
-	})
-}
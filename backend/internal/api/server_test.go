@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/user/subfinder-service/backend/internal/queue"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// newTestServer returns a server without authentication on a queue holding jobs
+func newTestServer(t *testing.T, jobs ...*models.Job) *Server {
+	t.Helper()
+	store := queue.NewMemoryStore()
+	for _, job := range jobs {
+		if err := store.Save(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q := queue.NewJobQueue(store, queue.DefaultCapacity)
+	return NewServer("0", q, nil, nil, nil, "", models.SubfinderConfig{}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// get sends a GET request for target to the server
+func get(s *Server, target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	s.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+	return recorder
+}
+
+// decode decodes the JSON body of a response with status 200 into v
+func decode(t *testing.T, recorder *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", recorder.Code, recorder.Body)
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), v); err != nil {
+		t.Fatal(err)
+	}
+}
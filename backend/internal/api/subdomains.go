@@ -0,0 +1,188 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// Page size limits of the subdomain list
+const (
+	defaultSubdomainsLimit = 100
+	maxSubdomainsLimit     = 1000
+)
+
+// subdomainQuery holds the parsed query parameters of the subdomain list
+type subdomainQuery struct {
+	contains string
+	pattern  *regexp.Regexp
+	sources  map[string]bool
+	hasIP    *bool
+	offset   int
+	limit    int
+	cursor   string
+}
+
+// handleGetSubdomains handles the subdomain list of a job. Subdomains are
+// sorted by hostname, can be filtered by hostname, source and whether an IP
+// was resolved, and are returned in pages selected by offset or cursor.
+func (s *Server) handleGetSubdomains(c *gin.Context) {
+	id := c.Param("id")
+
+	query, err := parseSubdomainQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	job, ok := s.getJob(c, id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Job %s not found", id),
+		})
+		return
+	}
+
+	// Filter the subdomains and sort them by hostname
+	matched := make([]models.SubdomainInfo, 0)
+	for _, info := range job.Subdomains {
+		if query.matches(info) {
+			matched = append(matched, info)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].Subdomain < matched[j].Subdomain
+	})
+
+	// Skip to the offset or to the subdomain after the cursor
+	start := query.offset
+	if query.cursor != "" {
+		start = sort.Search(len(matched), func(i int) bool {
+			return matched[i].Subdomain > query.cursor
+		})
+	}
+	if start > len(matched) {
+		start = len(matched)
+	}
+	end := start + query.limit
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	s.logger.DebugContext(c.Request.Context(), "Listing subdomains", "job_id", id, "listed", end-start, "matched", len(matched))
+
+	response := gin.H{
+		"job_id":     job.ID,
+		"status":     job.Status,
+		"subdomains": matched[start:end],
+		"total":      len(matched),
+		"offset":     start,
+	}
+	if end < len(matched) {
+		response["next_cursor"] = base64.RawURLEncoding.EncodeToString([]byte(matched[end-1].Subdomain))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// parseSubdomainQuery reads the filter and paging parameters of the subdomain list
+func parseSubdomainQuery(c *gin.Context) (*subdomainQuery, error) {
+	query := &subdomainQuery{
+		contains: strings.ToLower(strings.TrimSpace(c.Query("contains"))),
+		limit:    defaultSubdomainsLimit,
+	}
+
+	if value := c.Query("regex"); value != "" {
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %q: %v", value, err)
+		}
+		query.pattern = pattern
+	}
+
+	if value := c.Query("source"); value != "" {
+		query.sources = make(map[string]bool)
+		for _, source := range strings.Split(value, ",") {
+			if source = strings.TrimSpace(source); source != "" {
+				query.sources[source] = true
+			}
+		}
+	}
+
+	if value := c.Query("has_ip"); value != "" {
+		hasIP, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid has_ip %q, expected true or false", value)
+		}
+		query.hasIP = &hasIP
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxSubdomainsLimit {
+			return nil, fmt.Errorf("invalid limit %q, expected 1 to %d", value, maxSubdomainsLimit)
+		}
+		query.limit = limit
+	}
+
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid offset %q", value)
+		}
+		query.offset = offset
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		if query.offset > 0 {
+			return nil, errors.New("offset and cursor cannot be combined")
+		}
+		raw, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(raw) == 0 {
+			return nil, errors.New("invalid cursor")
+		}
+		query.cursor = string(raw)
+	}
+
+	return query, nil
+}
+
+// matches reports whether a subdomain passes the filters of the query
+func (q *subdomainQuery) matches(info models.SubdomainInfo) bool {
+	if q.contains != "" && !strings.Contains(strings.ToLower(info.Subdomain), q.contains) {
+		return false
+	}
+	if q.pattern != nil && !q.pattern.MatchString(info.Subdomain) {
+		return false
+	}
+	if q.sources != nil && !q.fromSource(info) {
+		return false
+	}
+	if q.hasIP != nil && (info.IP != "") != *q.hasIP {
+		return false
+	}
+	return true
+}
+
+// fromSource reports whether any source that reported the subdomain was requested
+func (q *subdomainQuery) fromSource(info models.SubdomainInfo) bool {
+	if q.sources[info.Source] {
+		return true
+	}
+	for _, source := range info.Sources {
+		if q.sources[source] {
+			return true
+		}
+	}
+	return false
+}
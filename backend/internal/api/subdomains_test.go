@@ -0,0 +1,171 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// subdomainList is the response of the subdomain list
+type subdomainList struct {
+	Subdomains []models.SubdomainInfo `json:"subdomains"`
+	Total      int                    `json:"total"`
+	Offset     int                    `json:"offset"`
+	NextCursor string                 `json:"next_cursor"`
+}
+
+// newSubdomainServer returns a server holding a completed job with subdomains, unsorted
+func newSubdomainServer(t *testing.T) *Server {
+	return newTestServer(t, &models.Job{
+		ID:        "job",
+		Domain:    "example.com",
+		Status:    models.JobStatusCompleted,
+		CreatedAt: time.Now(),
+		Subdomains: []models.SubdomainInfo{
+			{Subdomain: "www.example.com", IP: "192.0.2.1", Source: "crtsh", Sources: []string{"crtsh"}},
+			{Subdomain: "api.example.com", Source: "anubis", Sources: []string{"anubis", "crtsh"}},
+			{Subdomain: "mail.example.com", IP: "192.0.2.2", Source: "anubis", Sources: []string{"anubis"}},
+			{Subdomain: "api2.example.com", Source: "hackertarget", Sources: []string{"hackertarget"}},
+			{Subdomain: "dev.api.example.com", IP: "192.0.2.3", Source: "crtsh", Sources: []string{"crtsh"}},
+		},
+	})
+}
+
+// hostnames returns the hostnames of subdomains
+func hostnames(subdomains []models.SubdomainInfo) []string {
+	names := []string{}
+	for _, info := range subdomains {
+		names = append(names, info.Subdomain)
+	}
+	return names
+}
+
+func TestListSubdomainsFilters(t *testing.T) {
+	s := newSubdomainServer(t)
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  []string
+	}{
+		{
+			name: "sorted by hostname",
+			want: []string{"api.example.com", "api2.example.com", "dev.api.example.com", "mail.example.com", "www.example.com"},
+		},
+		{
+			name:  "contains ignores case",
+			query: url.Values{"contains": {" API "}},
+			want:  []string{"api.example.com", "api2.example.com", "dev.api.example.com"},
+		},
+		{
+			name:  "regex",
+			query: url.Values{"regex": {`^api\d*\.`}},
+			want:  []string{"api.example.com", "api2.example.com"},
+		},
+		{
+			name:  "regex matches anywhere unless anchored",
+			query: url.Values{"regex": {`api\.example`}},
+			want:  []string{"api.example.com", "dev.api.example.com"},
+		},
+		{
+			name:  "regex and contains combined",
+			query: url.Values{"regex": {`^[a-z]+\.example\.com$`}, "contains": {"i"}},
+			want:  []string{"api.example.com", "mail.example.com"},
+		},
+		{
+			name:  "any of the sources that found a subdomain",
+			query: url.Values{"source": {"crtsh"}},
+			want:  []string{"api.example.com", "dev.api.example.com", "www.example.com"},
+		},
+		{
+			name:  "with IP",
+			query: url.Values{"has_ip": {"true"}},
+			want:  []string{"dev.api.example.com", "mail.example.com", "www.example.com"},
+		},
+		{
+			name:  "without IP",
+			query: url.Values{"has_ip": {"false"}, "source": {"anubis,hackertarget"}},
+			want:  []string{"api.example.com", "api2.example.com"},
+		},
+		{
+			name:  "no matches",
+			query: url.Values{"regex": {`^ftp\.`}},
+			want:  []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var list subdomainList
+			decode(t, get(s, "/subfinder/job/subdomains?"+test.query.Encode()), &list)
+			if got := hostnames(list.Subdomains); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			if list.Total != len(test.want) || list.NextCursor != "" {
+				t.Errorf("got total %d and cursor %q for %d subdomains", list.Total, list.NextCursor, len(test.want))
+			}
+		})
+	}
+}
+
+func TestListSubdomainsPages(t *testing.T) {
+	s := newSubdomainServer(t)
+	all := []string{"api.example.com", "api2.example.com", "dev.api.example.com", "mail.example.com", "www.example.com"}
+
+	// Follow the cursors two subdomains at a time
+	var got []string
+	query := url.Values{"limit": {"2"}}
+	for page := 0; ; page++ {
+		var list subdomainList
+		decode(t, get(s, "/subfinder/job/subdomains?"+query.Encode()), &list)
+		if list.Total != len(all) || list.Offset != 2*page {
+			t.Errorf("page %d: got total %d and offset %d", page, list.Total, list.Offset)
+		}
+		got = append(got, hostnames(list.Subdomains)...)
+		if list.NextCursor == "" {
+			break
+		}
+		if page > len(all) {
+			t.Fatal("cursors do not end")
+		}
+		query.Set("cursor", list.NextCursor)
+	}
+	if !reflect.DeepEqual(got, all) {
+		t.Errorf("got %v through cursors, want %v", got, all)
+	}
+
+	// Pages by offset, past the end too
+	for offset, want := range map[int][]string{0: all[:2], 3: all[3:], 5: {}, 9: {}} {
+		var list subdomainList
+		decode(t, get(s, fmt.Sprintf("/subfinder/job/subdomains?limit=2&offset=%d", offset)), &list)
+		if got := hostnames(list.Subdomains); !reflect.DeepEqual(got, want) {
+			t.Errorf("offset %d: got %v, want %v", offset, got, want)
+		}
+	}
+}
+
+func TestListSubdomainsRejectsInvalidQueries(t *testing.T) {
+	s := newSubdomainServer(t)
+	for _, query := range []string{
+		"regex=" + url.QueryEscape("(api"),
+		"has_ip=maybe",
+		"limit=0",
+		"limit=1001",
+		"offset=-1",
+		"cursor=%21%21",
+		"offset=1&cursor=YQ",
+	} {
+		if recorder := get(s, "/subfinder/job/subdomains?"+query); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want 400", query, recorder.Code)
+		}
+	}
+
+	if recorder := get(s, "/subfinder/missing/subdomains"); recorder.Code != http.StatusNotFound {
+		t.Errorf("unknown job: got status %d, want 404", recorder.Code)
+	}
+}
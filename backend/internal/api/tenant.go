@@ -0,0 +1,64 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// tenant returns the tenant of the API key that authenticated the request, or
+// an empty string when authentication is disabled
+func tenant(c *gin.Context) string {
+	if key := apiKey(c); key != nil {
+		return key.Tenant
+	}
+	return ""
+}
+
+// owns reports whether the caller may access a resource of the given tenant.
+// Without authentication every resource is accessible.
+func (s *Server) owns(c *gin.Context, owner string) bool {
+	return s.auth == nil || owner == tenant(c)
+}
+
+// getJob returns a job by ID if it belongs to the caller's tenant
+func (s *Server) getJob(c *gin.Context, id string) (*models.Job, bool) {
+	job, ok := s.queue.Get(id)
+	if !ok || !s.owns(c, job.Tenant) {
+		return nil, false
+	}
+	return job, true
+}
+
+// listJobs returns the jobs of the caller's tenant without their subdomains, log and diff
+func (s *Server) listJobs(c *gin.Context) []*models.Job {
+	jobs := s.queue.Summaries()
+	if s.auth == nil {
+		return jobs
+	}
+
+	owned := jobs[:0]
+	for _, job := range jobs {
+		if s.owns(c, job.Tenant) {
+			owned = append(owned, job)
+		}
+	}
+	return owned
+}
+
+// getBatch returns a batch by ID if it belongs to the caller's tenant
+func (s *Server) getBatch(c *gin.Context, id string) (*models.Batch, bool) {
+	batch, ok := s.queue.GetBatch(id)
+	if !ok || !s.owns(c, batch.Tenant) {
+		return nil, false
+	}
+	return batch, true
+}
+
+// getSchedule returns a schedule by ID if it belongs to the caller's tenant
+func (s *Server) getSchedule(c *gin.Context, id string) (*models.Schedule, bool) {
+	schedule, ok := s.scheduler.Get(id)
+	if !ok || !s.owns(c, schedule.Tenant) {
+		return nil, false
+	}
+	return schedule, true
+}
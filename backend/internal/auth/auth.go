@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// keyPrefix marks strings issued as API keys
+const keyPrefix = "sfs_"
+
+// Errors
+var (
+	ErrInvalidKey    = errors.New("invalid API key")
+	ErrKeyNotFound   = errors.New("API key not found")
+	ErrInvalidLimits = errors.New("limits must not be negative")
+	ErrQuotaExceeded = errors.New("quota exceeded")
+)
+
+// Manager issues, revokes and checks API keys
+type Manager struct {
+	store Store
+	mutex sync.Mutex
+
+	// Serializes quota checks with the submissions they allow unless the
+	// store provides a lock shared by all replicas
+	quotaMutex sync.Mutex
+}
+
+// NewManager creates a new key manager
+func NewManager(store Store) *Manager {
+	return &Manager{
+		store: store,
+	}
+}
+
+// Create issues a new API key and returns it along with the key string,
+// which cannot be recovered later
+func (m *Manager) Create(request models.APIKeyRequest) (*models.APIKey, string, error) {
+	if request.MaxConcurrentJobs < 0 || request.MaxJobsPerDay < 0 {
+		return nil, "", ErrInvalidLimits
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate key: %v", err)
+	}
+	raw := keyPrefix + hex.EncodeToString(secret)
+
+	name := strings.TrimSpace(request.Name)
+	tenant := strings.TrimSpace(request.Tenant)
+	if tenant == "" {
+		tenant = name
+	}
+
+	key := &models.APIKey{
+		ID:                uuid.New().String(),
+		Name:              name,
+		Tenant:            tenant,
+		Prefix:            raw[:len(keyPrefix)+8],
+		Hash:              hash(raw),
+		MaxConcurrentJobs: request.MaxConcurrentJobs,
+		MaxJobsPerDay:     request.MaxJobsPerDay,
+		CreatedAt:         time.Now(),
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.store.Save(key); err != nil {
+		return nil, "", err
+	}
+	return key, raw, nil
+}
+
+// Revoke marks a key as revoked so it is no longer accepted
+func (m *Manager) Revoke(id string) (*models.APIKey, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key, ok := m.store.Get(id)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+		if err := m.store.Save(key); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// List returns all keys sorted by creation time
+func (m *Manager) List() []*models.APIKey {
+	keys := m.store.List()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// Authenticate returns the active key matching raw
+func (m *Manager) Authenticate(raw string) (*models.APIKey, error) {
+	if !strings.HasPrefix(raw, keyPrefix) {
+		return nil, ErrInvalidKey
+	}
+
+	key, ok := m.store.GetByHash(hash(raw))
+	if !ok || key.RevokedAt != nil {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// ActiveJobs returns the number of queued and running jobs submitted with a key
+type ActiveJobs func(keyID string) int
+
+// dayLayout formats the UTC day that submissions are counted for
+const dayLayout = "2006-01-02"
+
+// Key returns an active key by ID
+func (m *Manager) Key(id string) (*models.APIKey, error) {
+	key, ok := m.store.Get(id)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	if key.RevokedAt != nil {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// Reserve returns ErrQuotaExceeded if submitting count more jobs with key
+// would exceed its limits, and otherwise counts them as submitted today.
+// active returns the number of queued and running jobs of the key. Reserving
+// for the same key waits until the returned function is called, which must
+// happen once the jobs are enqueued, with false if they were not so they no
+// longer count. Deleting jobs later does not give their quota back.
+func (m *Manager) Reserve(key *models.APIKey, count int, active ActiveJobs, now time.Time) (func(enqueued bool), error) {
+	if key.MaxConcurrentJobs == 0 && key.MaxJobsPerDay == 0 {
+		return func(bool) {}, nil
+	}
+
+	unlock, err := m.lock(key.ID)
+	if err != nil {
+		return nil, err
+	}
+	if key.MaxConcurrentJobs > 0 {
+		if running := active(key.ID); running+count > key.MaxConcurrentJobs {
+			unlock()
+			return nil, fmt.Errorf("%w: %d of %d concurrent jobs in use", ErrQuotaExceeded, running, key.MaxConcurrentJobs)
+		}
+	}
+
+	day := now.UTC().Format(dayLayout)
+	used, added, err := m.store.AddUsage(key.ID, day, count, key.MaxJobsPerDay)
+	if err != nil {
+		unlock()
+		return nil, fmt.Errorf("failed to count jobs of key %s: %v", key.ID, err)
+	}
+	if !added {
+		unlock()
+		return nil, fmt.Errorf("%w: %d of %d jobs submitted today", ErrQuotaExceeded, used, key.MaxJobsPerDay)
+	}
+
+	return func(enqueued bool) {
+		if !enqueued {
+			m.store.AddUsage(key.ID, day, -count, 0)
+		}
+		unlock()
+	}, nil
+}
+
+// lock serializes quota checks of a key, across all replicas if the store is shared
+func (m *Manager) lock(id string) (func(), error) {
+	if locker, ok := m.store.(Locker); ok {
+		return locker.Lock(id)
+	}
+	m.quotaMutex.Lock()
+	return m.quotaMutex.Unlock, nil
+}
+
+// hash returns the hex-encoded SHA-256 hash of an API key
+func hash(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/user/subfinder-service/backend/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestReserveCountsSubmissionsPerDay(t *testing.T) {
+	m := NewManager(NewMemoryStore())
+	key, _, err := m.Create(models.APIKeyRequest{Name: "alice", MaxJobsPerDay: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noJobs := func(string) int { return 0 }
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC)
+
+	release, err := m.Reserve(key, 1, noJobs, now)
+	if err != nil {
+		t.Fatalf("first submission: %v", err)
+	}
+	release(true)
+
+	// The job is gone from the store, but it was still submitted today
+	if _, err := m.Reserve(key, 1, noJobs, now.Add(time.Hour)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("second submission: got %v, want ErrQuotaExceeded", err)
+	}
+
+	release, err = m.Reserve(key, 1, noJobs, now.Add(12*time.Hour))
+	if err != nil {
+		t.Fatalf("submission on the next day: %v", err)
+	}
+	release(true)
+}
+
+func TestReserveGivesBackJobsNotEnqueued(t *testing.T) {
+	m := NewManager(NewMemoryStore())
+	key, _, err := m.Create(models.APIKeyRequest{Name: "alice", MaxJobsPerDay: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noJobs := func(string) int { return 0 }
+	now := time.Now()
+
+	release, err := m.Reserve(key, 2, noJobs, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(false)
+
+	release, err = m.Reserve(key, 2, noJobs, now)
+	if err != nil {
+		t.Fatalf("jobs that were not enqueued still count: %v", err)
+	}
+	release(true)
+}
+
+func TestReserveLimitsActiveJobs(t *testing.T) {
+	m := NewManager(NewMemoryStore())
+	key, _, err := m.Create(models.APIKeyRequest{Name: "alice", MaxConcurrentJobs: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	active := func(id string) int {
+		if id != key.ID {
+			t.Errorf("active jobs requested for key %s, want %s", id, key.ID)
+		}
+		return 2
+	}
+
+	if _, err := m.Reserve(key, 2, active, time.Now()); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("got %v, want ErrQuotaExceeded", err)
+	}
+	release, err := m.Reserve(key, 1, active, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(true)
+}
+
+func TestReserveLimitsActiveJobsAcrossReplicas(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	// Each replica has its own manager on the shared Redis store
+	var replicas []*Manager
+	for i := 0; i < 2; i++ {
+		store, err := NewRedisStore(client, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		replicas = append(replicas, NewManager(store))
+	}
+	key, _, err := replicas[0].Create(models.APIKeyRequest{Name: "alice", MaxConcurrentJobs: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Jobs are counted as active once they are enqueued, like in the job store
+	var enqueued atomic.Int32
+	active := func(string) int { return int(enqueued.Load()) }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(m *Manager) {
+			defer wg.Done()
+			release, err := m.Reserve(key, 1, active, time.Now())
+			if errors.Is(err, ErrQuotaExceeded) {
+				return
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			time.Sleep(time.Millisecond)
+			enqueued.Add(1)
+			release(true)
+		}(replicas[i%len(replicas)])
+	}
+	wg.Wait()
+
+	if n := enqueued.Load(); n != 3 {
+		t.Errorf("%d jobs enqueued, want 3", n)
+	}
+}
+
+func TestAuthenticateFindsKeysByHash(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "keys.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	// A key saved before keys were indexed by hash, which the stores index when created
+	legacy, legacyRaw := &models.APIKey{ID: "legacy", Name: "legacy", CreatedAt: time.Now()}, keyPrefix+"legacy"
+	legacy.Hash = hash(legacyRaw)
+	data, err := json.Marshal(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucket(keysBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(legacy.ID), data)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.HSet(context.Background(), "test:api_keys", legacy.ID, data).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	boltStore, err := NewBoltStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redisStore, err := NewRedisStore(client, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	memoryStore := NewMemoryStore()
+	memoryStore.Save(legacy)
+
+	for name, store := range map[string]Store{"memory": memoryStore, "bolt": boltStore, "redis": redisStore} {
+		t.Run(name, func(t *testing.T) {
+			m := NewManager(store)
+			key, raw, err := m.Create(models.APIKeyRequest{Name: "alice"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			revoked, revokedRaw, err := m.Create(models.APIKeyRequest{Name: "bob"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := m.Revoke(revoked.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, err := m.Authenticate(raw); err != nil || got.ID != key.ID {
+				t.Errorf("new key: got %v, %v", got, err)
+			}
+			if got, err := m.Authenticate(legacyRaw); err != nil || got.ID != legacy.ID {
+				t.Errorf("legacy key: got %v, %v", got, err)
+			}
+			for _, raw := range []string{revokedRaw, keyPrefix + "unknown", "unknown"} {
+				if _, err := m.Authenticate(raw); !errors.Is(err, ErrInvalidKey) {
+					t.Errorf("%s: got %v, want ErrInvalidKey", raw, err)
+				}
+			}
+		})
+	}
+}
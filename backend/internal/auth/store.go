@@ -0,0 +1,434 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/user/subfinder-service/backend/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store persists API keys
+type Store interface {
+	// Save inserts or replaces a key
+	Save(key *models.APIKey) error
+
+	// Get returns a key by ID
+	Get(id string) (*models.APIKey, bool)
+
+	// GetByHash returns the key whose hash is hash
+	GetByHash(hash string) (*models.APIKey, bool)
+
+	// List returns all stored keys
+	List() []*models.APIKey
+
+	// AddUsage adds count to the jobs submitted with a key on day, a UTC date
+	// formatted as 2006-01-02, unless the total would exceed a positive limit.
+	// It returns the total before the addition and whether count was added.
+	// Only the most recent day is kept per key.
+	AddUsage(id, day string, count, limit int) (int, bool, error)
+}
+
+// Locker is implemented by stores shared between replicas of the service.
+// Lock blocks until this replica holds the quota lock of a key and returns a
+// function that releases it, so that quota checks of a key are serialized
+// across all replicas.
+type Locker interface {
+	Lock(id string) (func(), error)
+}
+
+// usage counts the jobs submitted with a key on one day
+type usage struct {
+	Day   string `json:"day"`
+	Count int    `json:"count"`
+}
+
+// add adds count to the usage of day unless the total would exceed a positive
+// limit, resetting the count when the day has changed
+func (u *usage) add(day string, count, limit int) (int, bool) {
+	if u.Day != day {
+		*u = usage{Day: day}
+	}
+	used := u.Count
+	if limit > 0 && used+count > limit {
+		return used, false
+	}
+	u.Count += count
+	if u.Count < 0 {
+		u.Count = 0
+	}
+	return used, true
+}
+
+// MemoryStore keeps API keys in an in-memory map
+type MemoryStore struct {
+	keys   map[string]*models.APIKey
+	hashes map[string]string
+	usage  map[string]*usage
+	mutex  sync.RWMutex
+}
+
+// NewMemoryStore creates a new in-memory key store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		keys:   make(map[string]*models.APIKey),
+		hashes: make(map[string]string),
+		usage:  make(map[string]*usage),
+	}
+}
+
+// Save stores a copy of the key in the map and indexes it by its hash
+func (s *MemoryStore) Save(key *models.APIKey) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored := *key
+	s.keys[key.ID] = &stored
+	s.hashes[key.Hash] = key.ID
+	return nil
+}
+
+// Get returns a copy of a key by ID
+func (s *MemoryStore) Get(id string) (*models.APIKey, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *key
+	return &copied, true
+}
+
+// GetByHash returns a copy of the key whose hash is hash
+func (s *MemoryStore) GetByHash(hash string) (*models.APIKey, bool) {
+	s.mutex.RLock()
+	id, ok := s.hashes[hash]
+	s.mutex.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return s.Get(id)
+}
+
+// List returns copies of all stored keys
+func (s *MemoryStore) List() []*models.APIKey {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	keys := make([]*models.APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		copied := *key
+		keys = append(keys, &copied)
+	}
+	return keys
+}
+
+// AddUsage adds count to the usage of a key on day
+func (s *MemoryStore) AddUsage(id, day string, count, limit int) (int, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	u, ok := s.usage[id]
+	if !ok {
+		u = &usage{}
+		s.usage[id] = u
+	}
+	used, added := u.add(day, count, limit)
+	return used, added, nil
+}
+
+// BoltDB buckets holding JSON-encoded API keys and their usage keyed by key
+// ID, and the key IDs keyed by key hash
+var (
+	keysBucket   = []byte("api_keys")
+	usageBucket  = []byte("api_key_usage")
+	hashesBucket = []byte("api_key_hashes")
+)
+
+// BoltStore keeps API keys in the BoltDB file shared with the job store
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore creates a key store in an open BoltDB database. Keys saved
+// before they were indexed by hash are indexed on the way.
+func NewBoltStore(db *bolt.DB) (*BoltStore, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{keysBucket, usageBucket, hashesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+
+		hashes := tx.Bucket(hashesBucket)
+		return tx.Bucket(keysBucket).ForEach(func(id, data []byte) error {
+			key := decodeKey(data)
+			if key == nil || hashes.Get([]byte(key.Hash)) != nil {
+				return nil
+			}
+			return hashes.Put([]byte(key.Hash), id)
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize key store: %v", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// Save writes the key to the database
+func (s *BoltStore) Save(key *models.APIKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode key %s: %v", key.ID, err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(keysBucket).Put([]byte(key.ID), data); err != nil {
+			return err
+		}
+		return tx.Bucket(hashesBucket).Put([]byte(key.Hash), []byte(key.ID))
+	})
+}
+
+// Get returns a key by ID
+func (s *BoltStore) Get(id string) (*models.APIKey, bool) {
+	var key *models.APIKey
+	s.db.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(keysBucket).Get([]byte(id)); data != nil {
+			key = decodeKey(data)
+		}
+		return nil
+	})
+
+	return key, key != nil
+}
+
+// GetByHash returns the key whose hash is hash
+func (s *BoltStore) GetByHash(hash string) (*models.APIKey, bool) {
+	var key *models.APIKey
+	s.db.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket(hashesBucket).Get([]byte(hash))
+		if id == nil {
+			return nil
+		}
+		if data := tx.Bucket(keysBucket).Get(id); data != nil {
+			key = decodeKey(data)
+		}
+		return nil
+	})
+
+	return key, key != nil
+}
+
+// List returns all stored keys
+func (s *BoltStore) List() []*models.APIKey {
+	var keys []*models.APIKey
+	s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(keysBucket).ForEach(func(_, data []byte) error {
+			if key := decodeKey(data); key != nil {
+				keys = append(keys, key)
+			}
+			return nil
+		})
+	})
+
+	return keys
+}
+
+// AddUsage adds count to the usage of a key on day in a single transaction
+func (s *BoltStore) AddUsage(id, day string, count, limit int) (int, bool, error) {
+	var used int
+	var added bool
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(usageBucket)
+
+		var u usage
+		if data := bucket.Get([]byte(id)); data != nil {
+			// A corrupt record counts as no usage
+			json.Unmarshal(data, &u)
+		}
+		used, added = u.add(day, count, limit)
+		if !added {
+			return nil
+		}
+
+		data, err := json.Marshal(u)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), data)
+	})
+	return used, added, err
+}
+
+// decodeKey decodes a JSON-encoded key, returning nil for corrupt records
+func decodeKey(data []byte) *models.APIKey {
+	var key models.APIKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil
+	}
+	return &key
+}
+
+// usageTTL is how long the usage of a day is kept in Redis, beyond the end
+// of the day in any time zone
+const usageTTL = 48 * time.Hour
+
+// addUsageScript adds to a usage counter unless the total would exceed a
+// positive limit. KEYS[1] is the counter; ARGV holds the count, the limit and
+// the TTL of the counter in seconds. It returns the total before the addition
+// and 1 if the count was added.
+var addUsageScript = redis.NewScript(`
+local used = tonumber(redis.call('GET', KEYS[1]) or '0')
+local count = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+if limit > 0 and used + count > limit then
+	return {used, 0}
+end
+if used + count < 0 then
+	count = -used
+end
+redis.call('INCRBY', KEYS[1], count)
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+return {used, 1}
+`)
+
+// lockTTL bounds how long a replica that stopped while holding the quota lock
+// of a key blocks the other replicas
+const lockTTL = 10 * time.Second
+
+// lockTimeout is how long Lock waits for the quota lock of a key
+const lockTimeout = 5 * time.Second
+
+// lockRetry is how often Lock tries again while another replica holds the lock
+const lockRetry = 10 * time.Millisecond
+
+// unlockScript deletes a lock only if it still holds the given token.
+// KEYS[1] is the lock; ARGV[1] is the token.
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisStore keeps API keys in a Redis hash shared by all replicas of the
+// service, and their IDs in a second hash keyed by key hash
+type RedisStore struct {
+	client *redis.Client
+	key    string
+}
+
+// NewRedisStore creates an API key store in the Redis database of the job
+// store, under prefix. Keys saved before they were indexed by hash are indexed
+// on the way.
+func NewRedisStore(client *redis.Client, prefix string) (*RedisStore, error) {
+	s := &RedisStore{client: client, key: prefix + ":api_keys"}
+
+	ctx := context.Background()
+	for _, key := range s.List() {
+		if err := s.client.HSetNX(ctx, s.hashesKey(), key.Hash, key.ID).Err(); err != nil {
+			return nil, fmt.Errorf("failed to index API keys: %v", err)
+		}
+	}
+	return s, nil
+}
+
+// AddUsage adds count to the usage counter of a key on day, which expires after usageTTL
+func (s *RedisStore) AddUsage(id, day string, count, limit int) (int, bool, error) {
+	key := s.key + ":usage:" + id + ":" + day
+	result, err := addUsageScript.Run(context.Background(), s.client, []string{key}, count, limit, int(usageTTL.Seconds())).Int64Slice()
+	if err != nil {
+		return 0, false, err
+	}
+	return int(result[0]), result[1] == 1, nil
+}
+
+// Lock takes the quota lock of a key, waiting up to lockTimeout while another
+// replica holds it
+func (s *RedisStore) Lock(id string) (func(), error) {
+	ctx := context.Background()
+	key := s.key + ":lock:" + id
+	token := uuid.New().String()
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		acquired, err := s.client.SetNX(ctx, key, token, lockTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			return func() {
+				unlockScript.Run(ctx, s.client, []string{key}, token)
+			}, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for the quota lock of key %s", id)
+		}
+		time.Sleep(lockRetry)
+	}
+}
+
+// Save writes the key to the hash
+func (s *RedisStore) Save(key *models.APIKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode key %s: %v", key.ID, err)
+	}
+
+	ctx := context.Background()
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, s.key, key.ID, data)
+		pipe.HSet(ctx, s.hashesKey(), key.Hash, key.ID)
+		return nil
+	})
+	return err
+}
+
+// Get returns a key by ID
+func (s *RedisStore) Get(id string) (*models.APIKey, bool) {
+	data, err := s.client.HGet(context.Background(), s.key, id).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	key := decodeKey(data)
+	return key, key != nil
+}
+
+// GetByHash returns the key whose hash is hash
+func (s *RedisStore) GetByHash(hash string) (*models.APIKey, bool) {
+	id, err := s.client.HGet(context.Background(), s.hashesKey(), hash).Result()
+	if err != nil {
+		return nil, false
+	}
+	return s.Get(id)
+}
+
+// List returns all stored keys
+func (s *RedisStore) List() []*models.APIKey {
+	values, err := s.client.HGetAll(context.Background(), s.key).Result()
+	if err != nil {
+		return nil
+	}
+
+	keys := make([]*models.APIKey, 0, len(values))
+	for _, data := range values {
+		if key := decodeKey([]byte(data)); key != nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// hashesKey returns the key of the hash holding the key IDs by key hash
+func (s *RedisStore) hashesKey() string {
+	return s.key + ":hashes"
+}
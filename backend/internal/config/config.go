@@ -0,0 +1,334 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/user/subfinder-service/backend/internal/queue"
+	"github.com/user/subfinder-service/backend/internal/retention"
+	"github.com/user/subfinder-service/backend/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the settings of the service
+type Config struct {
+	Server    Server    `yaml:"server"`
+	Workers   int       `yaml:"workers"`
+	Queue     Queue     `yaml:"queue"`
+	Jobs      Jobs      `yaml:"jobs"`
+	Store     Store     `yaml:"store"`
+	Subfinder Subfinder `yaml:"subfinder"`
+	Auth      Auth      `yaml:"auth"`
+	Providers Providers `yaml:"providers"`
+	Retention Retention `yaml:"retention"`
+	Log       Log       `yaml:"log"`
+}
+
+// Server holds the settings of the API server
+type Server struct {
+	// Port the API server listens on
+	Port string `yaml:"port"`
+
+	// Time in-flight requests get to finish on shutdown
+	ShutdownGrace Duration `yaml:"shutdown_grace"`
+}
+
+// Queue holds the settings of the job queue
+type Queue struct {
+	// Maximum number of jobs waiting in the queue
+	Capacity int `yaml:"capacity"`
+}
+
+// Jobs holds the options applied to jobs and schedules that do not set them
+type Jobs struct {
+	// Maximum depth level for subdomains
+	DefaultMaxDepth int `yaml:"default_max_depth"`
+
+	// Timeout in seconds
+	DefaultTimeout int `yaml:"default_timeout"`
+
+	// Rate limit in requests per second
+	DefaultRateLimit int `yaml:"default_rate_limit"`
+}
+
+// Store holds the settings of the job store
+type Store struct {
+	// Backend: "memory", "bolt" or "redis"
+	Kind string `yaml:"kind"`
+
+	// BoltDB file used by the bolt store
+	Path string `yaml:"path"`
+
+	// Redis server used by the redis store
+	RedisURL string `yaml:"redis_url"`
+
+	// Prefix of all Redis keys
+	RedisPrefix string `yaml:"redis_prefix"`
+}
+
+// Subfinder holds the settings of the subfinder client
+type Subfinder struct {
+	// How subfinder is run: "library" or "cli"
+	Client string `yaml:"client"`
+
+	// Provider config with API keys for the passive sources
+	ProviderConfig string `yaml:"provider_config"`
+}
+
+// Auth holds the settings of API key authentication
+type Auth struct {
+	// Whether requests require an API key
+	Enabled bool `yaml:"enabled"`
+
+	// Token for managing API keys and provider keys
+	AdminToken string `yaml:"admin_token"`
+}
+
+// Providers holds the settings of the provider key store
+type Providers struct {
+	// Base64-encoded 32-byte key that enables the encrypted provider key store
+	EncryptionKey string `yaml:"encryption_key"`
+}
+
+// Retention holds the retention policy for finished jobs
+type Retention struct {
+	MaxAge        Duration `yaml:"max_age"`
+	MaxJobs       int      `yaml:"max_jobs"`
+	KeepPerDomain int      `yaml:"keep_per_domain"`
+	Interval      Duration `yaml:"interval"`
+}
+
+// Log holds the settings of the logger
+type Log struct {
+	// Output format: "json" or "text"
+	Format string `yaml:"format"`
+
+	// Lowest level logged: "debug", "info", "warn" or "error"
+	Level string `yaml:"level"`
+}
+
+// Default returns the configuration used for settings that are not set elsewhere
+func Default() *Config {
+	jobs := models.DefaultSubfinderConfig()
+	return &Config{
+		Server: Server{
+			Port:          "8080",
+			ShutdownGrace: Duration(5 * time.Second),
+		},
+		Workers: 5,
+		Queue: Queue{
+			Capacity: queue.DefaultCapacity,
+		},
+		Jobs: Jobs{
+			DefaultMaxDepth:  jobs.MaxDepth,
+			DefaultTimeout:   jobs.Timeout,
+			DefaultRateLimit: jobs.RateLimit,
+		},
+		Store: Store{
+			Kind:        "memory",
+			Path:        "jobs.db",
+			RedisURL:    "redis://localhost:6379/0",
+			RedisPrefix: "subfinder",
+		},
+		Subfinder: Subfinder{
+			Client:         "library",
+			ProviderConfig: defaultProviderConfig(),
+		},
+		Retention: Retention{
+			Interval: Duration(retention.DefaultInterval),
+		},
+		Log: Log{
+			Format: "json",
+			Level:  "info",
+		},
+	}
+}
+
+// JobDefaults returns the options applied to jobs that do not set them
+func (c *Config) JobDefaults() models.SubfinderConfig {
+	return models.SubfinderConfig{
+		MaxDepth:  c.Jobs.DefaultMaxDepth,
+		Timeout:   c.Jobs.DefaultTimeout,
+		RateLimit: c.Jobs.DefaultRateLimit,
+	}
+}
+
+// RetentionPolicy returns the configured retention policy
+func (c *Config) RetentionPolicy() retention.Policy {
+	return retention.Policy{
+		MaxAge:        time.Duration(c.Retention.MaxAge),
+		MaxJobs:       c.Retention.MaxJobs,
+		KeepPerDomain: c.Retention.KeepPerDomain,
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file named by
+// --config or CONFIG_FILE, environment variables and command line flags, each
+// overriding the previous ones, and validates it. printConfig reports whether
+// --print-config was given. If args ask for help, the usage is written to
+// output and flag.ErrHelp is returned.
+func Load(args []string, output io.Writer) (cfg *Config, printConfig bool, err error) {
+	cfg = Default()
+	options := cfg.options()
+
+	// Parse the flags first to find the config file, but apply them last
+	var path string
+	var apply []func() error
+	flags := flag.NewFlagSet("subfinder-service", flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.StringVar(&path, "config", "", "YAML config file (env CONFIG_FILE)")
+	flags.BoolVar(&printConfig, "print-config", false, "print the effective config and exit")
+	for _, o := range options {
+		if o.flag == "" {
+			continue
+		}
+		o := o
+		usage := fmt.Sprintf("%s (env %s)", o.usage, o.env)
+		record := func(value string) error {
+			apply = append(apply, func() error {
+				if err := o.set(value); err != nil {
+					return fmt.Errorf("flag -%s: %v", o.flag, err)
+				}
+				return nil
+			})
+			return nil
+		}
+		if o.isBool {
+			flags.BoolFunc(o.flag, usage, record)
+		} else {
+			flags.Func(o.flag, usage, record)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, false, err
+	}
+	if flags.NArg() > 0 {
+		return nil, false, fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, false, err
+		}
+	}
+
+	for _, o := range options {
+		if value, ok := os.LookupEnv(o.env); ok {
+			if err := o.set(value); err != nil {
+				return nil, false, fmt.Errorf("env %s: %v", o.env, err)
+			}
+		}
+	}
+
+	for _, set := range apply {
+		if err := set(); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, false, err
+	}
+	return cfg, printConfig, nil
+}
+
+// loadFile overrides the settings present in the YAML file at path. Unknown keys are rejected.
+func (c *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %v", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Validate reports all settings with invalid values
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	port, err := strconv.Atoi(c.Server.Port)
+	check(err == nil && port > 0 && port < 65536, "server.port", "%q is not a port number", c.Server.Port)
+	check(c.Server.ShutdownGrace > 0, "server.shutdown_grace", "must be positive")
+	check(c.Workers > 0, "workers", "must be at least 1")
+	check(c.Queue.Capacity > 0, "queue.capacity", "must be at least 1")
+	check(c.Jobs.DefaultMaxDepth > 0, "jobs.default_max_depth", "must be at least 1")
+	check(c.Jobs.DefaultTimeout > 0, "jobs.default_timeout", "must be at least 1")
+	check(c.Jobs.DefaultRateLimit > 0, "jobs.default_rate_limit", "must be at least 1")
+
+	switch c.Store.Kind {
+	case "memory":
+	case "bolt":
+		check(c.Store.Path != "", "store.path", "is required for the bolt store")
+	case "redis":
+		check(c.Store.RedisURL != "", "store.redis_url", "is required for the redis store")
+		check(c.Store.RedisPrefix != "", "store.redis_prefix", "is required for the redis store")
+	default:
+		check(false, "store.kind", "%q is not memory, bolt or redis", c.Store.Kind)
+	}
+
+	check(c.Subfinder.Client == "library" || c.Subfinder.Client == "cli", "subfinder.client", "%q is not library or cli", c.Subfinder.Client)
+	check(!c.Auth.Enabled || c.Auth.AdminToken != "", "auth.admin_token", "is required when auth is enabled")
+	check(c.Providers.EncryptionKey == "" || c.Auth.AdminToken != "", "auth.admin_token", "is required when the provider key store is enabled")
+
+	check(c.Retention.MaxAge >= 0, "retention.max_age", "must not be negative")
+	check(c.Retention.MaxJobs >= 0, "retention.max_jobs", "must not be negative")
+	check(c.Retention.KeepPerDomain >= 0, "retention.keep_per_domain", "must not be negative")
+	check(c.Retention.Interval > 0, "retention.interval", "must be positive")
+
+	check(c.Log.Format == "json" || c.Log.Format == "text", "log.format", "%q is not json or text", c.Log.Format)
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "log.level", "%q is not debug, info, warn or error", c.Log.Level)
+	}
+
+	return errors.Join(errs...)
+}
+
+// redacted is shown instead of secrets
+const redacted = "<redacted>"
+
+// YAML returns the configuration as YAML with secrets redacted
+func (c *Config) YAML() ([]byte, error) {
+	printed := *c
+	if printed.Auth.AdminToken != "" {
+		printed.Auth.AdminToken = redacted
+	}
+	if printed.Providers.EncryptionKey != "" {
+		printed.Providers.EncryptionKey = redacted
+	}
+	if u, err := url.Parse(printed.Store.RedisURL); err == nil {
+		printed.Store.RedisURL = u.Redacted()
+	}
+	return yaml.Marshal(&printed)
+}
+
+// defaultProviderConfig returns the location subfinder uses for its provider config by default
+func defaultProviderConfig() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "subfinder", "provider-config.yaml")
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// option is a setting that can be set by an environment variable and,
+// unless it is a secret, a command line flag
+type option struct {
+	// Environment variable
+	env string
+
+	// Command line flag, empty for secrets that would be visible in the process list
+	flag string
+
+	// Description shown in the flag usage
+	usage string
+
+	// Whether the flag can be given without a value
+	isBool bool
+
+	// Parses a value and stores it in the config
+	set func(value string) error
+}
+
+// options lists the settings of c that can be set by environment variables and flags
+func (c *Config) options() []option {
+	return []option{
+		{env: "PORT", flag: "port", usage: "port the API server listens on", set: stringVar(&c.Server.Port)},
+		{env: "SHUTDOWN_GRACE", flag: "shutdown-grace", usage: "time in-flight requests get to finish on shutdown", set: durationVar(&c.Server.ShutdownGrace)},
+		{env: "WORKER_COUNT", flag: "workers", usage: "number of concurrent workers", set: intVar(&c.Workers)},
+		{env: "QUEUE_CAPACITY", flag: "queue-capacity", usage: "maximum number of jobs waiting in the queue", set: intVar(&c.Queue.Capacity)},
+		{env: "JOB_DEFAULT_MAX_DEPTH", flag: "job-default-max-depth", usage: "max_depth of jobs that do not set it", set: intVar(&c.Jobs.DefaultMaxDepth)},
+		{env: "JOB_DEFAULT_TIMEOUT", flag: "job-default-timeout", usage: "timeout in seconds of jobs that do not set it", set: intVar(&c.Jobs.DefaultTimeout)},
+		{env: "JOB_DEFAULT_RATE_LIMIT", flag: "job-default-rate-limit", usage: "rate_limit of jobs that do not set it", set: intVar(&c.Jobs.DefaultRateLimit)},
+		{env: "JOB_STORE", flag: "store", usage: "job store: memory, bolt or redis", set: stringVar(&c.Store.Kind)},
+		{env: "JOB_STORE_PATH", flag: "store-path", usage: "BoltDB file of the bolt store", set: stringVar(&c.Store.Path)},
+		{env: "REDIS_URL", usage: "Redis server of the redis store", set: stringVar(&c.Store.RedisURL)},
+		{env: "REDIS_PREFIX", flag: "redis-prefix", usage: "prefix of all Redis keys", set: stringVar(&c.Store.RedisPrefix)},
+		{env: "SUBFINDER_CLIENT", flag: "subfinder-client", usage: "how subfinder is run: library or cli", set: stringVar(&c.Subfinder.Client)},
+		{env: "SUBFINDER_PROVIDER_CONFIG", flag: "subfinder-provider-config", usage: "provider config with API keys for the passive sources", set: stringVar(&c.Subfinder.ProviderConfig)},
+		{env: "AUTH_ENABLED", flag: "auth-enabled", usage: "require API keys on /subfinder routes", isBool: true, set: boolVar(&c.Auth.Enabled)},
+		{env: "ADMIN_TOKEN", usage: "token for the /admin endpoints", set: stringVar(&c.Auth.AdminToken)},
+		{env: "PROVIDER_ENCRYPTION_KEY", usage: "key that enables the encrypted provider key store", set: stringVar(&c.Providers.EncryptionKey)},
+		{env: "RETENTION_MAX_AGE", flag: "retention-max-age", usage: "purge finished jobs older than this", set: durationVar(&c.Retention.MaxAge)},
+		{env: "RETENTION_MAX_JOBS", flag: "retention-max-jobs", usage: "purge the oldest finished jobs while more jobs are stored", set: intVar(&c.Retention.MaxJobs)},
+		{env: "RETENTION_KEEP_PER_DOMAIN", flag: "retention-keep-per-domain", usage: "keep only the most recent finished jobs per domain", set: intVar(&c.Retention.KeepPerDomain)},
+		{env: "RETENTION_INTERVAL", flag: "retention-interval", usage: "time between retention runs", set: durationVar(&c.Retention.Interval)},
+		{env: "LOG_FORMAT", flag: "log-format", usage: "log output: json or text", set: stringVar(&c.Log.Format)},
+		{env: "LOG_LEVEL", flag: "log-level", usage: "lowest level logged: debug, info, warn or error", set: stringVar(&c.Log.Level)},
+	}
+}
+
+// stringVar returns a setter of a string setting
+func stringVar(p *string) func(string) error {
+	return func(value string) error {
+		*p = value
+		return nil
+	}
+}
+
+// intVar returns a setter of an integer setting
+func intVar(p *int) func(string) error {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		*p = n
+		return nil
+	}
+}
+
+// boolVar returns a setter of a boolean setting
+func boolVar(p *bool) func(string) error {
+	return func(value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		*p = b
+		return nil
+	}
+}
+
+// durationVar returns a setter of a duration setting
+func durationVar(p *Duration) func(string) error {
+	return func(value string) error {
+		return p.parse(value)
+	}
+}
+
+// Duration is a time.Duration written like "30s" or "72h" in YAML
+type Duration time.Duration
+
+// MarshalYAML writes the duration as a string
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+// UnmarshalYAML reads a duration string
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var value string
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	if err := d.parse(value); err != nil {
+		return fmt.Errorf("line %d: %v", node.Line, err)
+	}
+	return nil
+}
+
+// parse reads a duration string
+func (d *Duration) parse(value string) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%q is not a duration like 30s or 72h", value)
+	}
+	*d = Duration(duration)
+	return nil
+}
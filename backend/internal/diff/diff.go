@@ -0,0 +1,90 @@
+package diff
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// Compare returns the subdomains added and removed between two jobs, compared
+// by hostname. IP changes are only reported when both jobs resolved IPs.
+func Compare(from, to *models.Job) *models.JobDiff {
+	result := &models.JobDiff{
+		FromJobID: from.ID,
+		ToJobID:   to.ID,
+		Added:     []models.SubdomainInfo{},
+		Removed:   []models.SubdomainInfo{},
+		IPChanged: []models.SubdomainChange{},
+	}
+
+	before := index(from.Subdomains)
+	after := index(to.Subdomains)
+	compareIPs := from.Config.IncludeIPs && to.Config.IncludeIPs
+
+	for host, info := range after {
+		old, ok := before[host]
+		if !ok {
+			result.Added = append(result.Added, info)
+			continue
+		}
+		if compareIPs && old.IP != info.IP {
+			result.IPChanged = append(result.IPChanged, models.SubdomainChange{
+				Subdomain: info.Subdomain,
+				OldIP:     old.IP,
+				NewIP:     info.IP,
+			})
+		}
+	}
+
+	for host, info := range before {
+		if _, ok := after[host]; !ok {
+			result.Removed = append(result.Removed, info)
+		}
+	}
+
+	sortInfos(result.Added)
+	sortInfos(result.Removed)
+	sort.Slice(result.IPChanged, func(i, j int) bool {
+		return result.IPChanged[i].Subdomain < result.IPChanged[j].Subdomain
+	})
+
+	return result
+}
+
+// Previous returns the most recent completed job of the same tenant for the
+// same domain that finished before job, or nil if there is none
+func Previous(jobs []*models.Job, job *models.Job) *models.Job {
+	var previous *models.Job
+	for _, candidate := range jobs {
+		if candidate.ID == job.ID || candidate.Status != models.JobStatusCompleted || candidate.CompletedAt == nil {
+			continue
+		}
+		if candidate.Tenant != job.Tenant || !strings.EqualFold(candidate.Domain, job.Domain) {
+			continue
+		}
+		if job.CompletedAt != nil && !candidate.CompletedAt.Before(*job.CompletedAt) {
+			continue
+		}
+		if previous == nil || candidate.CompletedAt.After(*previous.CompletedAt) {
+			previous = candidate
+		}
+	}
+	return previous
+}
+
+// index maps the subdomains of a job by lower-cased hostname
+func index(infos []models.SubdomainInfo) map[string]models.SubdomainInfo {
+	hosts := make(map[string]models.SubdomainInfo, len(infos))
+	for _, info := range infos {
+		hosts[strings.ToLower(info.Subdomain)] = info
+	}
+	return hosts
+}
+
+// sortInfos sorts subdomains by hostname
+func sortInfos(infos []models.SubdomainInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Subdomain < infos[j].Subdomain
+	})
+}
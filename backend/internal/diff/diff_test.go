@@ -0,0 +1,181 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// completedJob returns a completed job for domain that finished at the given minute
+func completedJob(id, tenant, domain string, minute int) *models.Job {
+	at := time.Date(2025, 4, 4, 10, minute, 0, 0, time.UTC)
+	return &models.Job{
+		ID:          id,
+		Tenant:      tenant,
+		Domain:      domain,
+		Status:      models.JobStatusCompleted,
+		CompletedAt: &at,
+	}
+}
+
+// infos returns subdomains with the given hostnames and IPs, as alternating pairs
+func infos(pairs ...string) []models.SubdomainInfo {
+	result := []models.SubdomainInfo{}
+	for i := 0; i < len(pairs); i += 2 {
+		result = append(result, models.SubdomainInfo{Subdomain: pairs[i], IP: pairs[i+1]})
+	}
+	return result
+}
+
+func TestPrevious(t *testing.T) {
+	current := completedJob("current", "acme", "example.com", 30)
+
+	failed := completedJob("failed", "acme", "example.com", 20)
+	failed.Status = models.JobStatusFailed
+	running := completedJob("running", "acme", "example.com", 20)
+	running.Status = models.JobStatusRunning
+	running.CompletedAt = nil
+
+	tests := []struct {
+		name string
+		jobs []*models.Job
+		want string
+	}{
+		{
+			name: "no other jobs",
+			jobs: []*models.Job{current},
+		},
+		{
+			name: "most recent earlier job",
+			jobs: []*models.Job{
+				completedJob("older", "acme", "example.com", 10),
+				completedJob("newer", "acme", "example.com", 20),
+				current,
+			},
+			want: "newer",
+		},
+		{
+			name: "domain compared case-insensitively",
+			jobs: []*models.Job{completedJob("upper", "acme", "EXAMPLE.com", 10)},
+			want: "upper",
+		},
+		{
+			name: "other tenant",
+			jobs: []*models.Job{completedJob("other", "globex", "example.com", 20)},
+		},
+		{
+			name: "other domain",
+			jobs: []*models.Job{completedJob("other", "acme", "example.org", 20)},
+		},
+		{
+			name: "only completed jobs",
+			jobs: []*models.Job{
+				completedJob("completed", "acme", "example.com", 10),
+				failed,
+				running,
+			},
+			want: "completed",
+		},
+		{
+			name: "jobs finished later are ignored",
+			jobs: []*models.Job{
+				completedJob("earlier", "acme", "example.com", 10),
+				completedJob("later", "acme", "example.com", 40),
+			},
+			want: "earlier",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ""
+			if previous := Previous(test.jobs, current); previous != nil {
+				got = previous.ID
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name       string
+		from, to   []models.SubdomainInfo
+		includeIPs [2]bool
+		want       models.JobDiff
+	}{
+		{
+			name: "added and removed",
+			from: infos("a.example.com", "", "b.example.com", ""),
+			to:   infos("c.example.com", "", "b.example.com", ""),
+			want: models.JobDiff{
+				Added:     infos("c.example.com", ""),
+				Removed:   infos("a.example.com", ""),
+				IPChanged: []models.SubdomainChange{},
+			},
+		},
+		{
+			name: "hostnames compared case-insensitively",
+			from: infos("WWW.example.com", ""),
+			to:   infos("www.example.com", ""),
+			want: models.JobDiff{
+				Added:     infos(),
+				Removed:   infos(),
+				IPChanged: []models.SubdomainChange{},
+			},
+		},
+		{
+			name:       "IP changes when both jobs resolved IPs",
+			from:       infos("a.example.com", "192.0.2.1", "b.example.com", "192.0.2.2"),
+			to:         infos("b.example.com", "192.0.2.2", "a.example.com", "192.0.2.9"),
+			includeIPs: [2]bool{true, true},
+			want: models.JobDiff{
+				Added:     infos(),
+				Removed:   infos(),
+				IPChanged: []models.SubdomainChange{{Subdomain: "a.example.com", OldIP: "192.0.2.1", NewIP: "192.0.2.9"}},
+			},
+		},
+		{
+			name:       "no IP changes when one job did not resolve IPs",
+			from:       infos("a.example.com", ""),
+			to:         infos("a.example.com", "192.0.2.9"),
+			includeIPs: [2]bool{false, true},
+			want: models.JobDiff{
+				Added:     infos(),
+				Removed:   infos(),
+				IPChanged: []models.SubdomainChange{},
+			},
+		},
+		{
+			name: "results sorted by hostname",
+			from: infos(),
+			to:   infos("c.example.com", "", "a.example.com", "", "b.example.com", ""),
+			want: models.JobDiff{
+				Added:     infos("a.example.com", "", "b.example.com", "", "c.example.com", ""),
+				Removed:   infos(),
+				IPChanged: []models.SubdomainChange{},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			from := completedJob("from", "", "example.com", 10)
+			from.Subdomains = test.from
+			from.Config.IncludeIPs = test.includeIPs[0]
+			to := completedJob("to", "", "example.com", 20)
+			to.Subdomains = test.to
+			to.Config.IncludeIPs = test.includeIPs[1]
+
+			want := test.want
+			want.FromJobID, want.ToJobID = "from", "to"
+			if got := Compare(from, to); !reflect.DeepEqual(*got, want) {
+				t.Errorf("got %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// Format describes an export format
+type Format struct {
+	// Name of the format as used in the format query parameter
+	Name string
+
+	// MIME type of the exported file
+	ContentType string
+
+	// File extension, without the dot
+	Extension string
+
+	// Write writes the subdomains in this format
+	Write func(w io.Writer, subdomains []models.SubdomainInfo) error
+}
+
+// Formats lists the supported export formats by name
+var Formats = map[string]Format{
+	"csv": {
+		Name:        "csv",
+		ContentType: "text/csv; charset=utf-8",
+		Extension:   "csv",
+		Write:       WriteCSV,
+	},
+	"txt": {
+		Name:        "txt",
+		ContentType: "text/plain; charset=utf-8",
+		Extension:   "txt",
+		Write:       WriteText,
+	},
+	"jsonl": {
+		Name:        "jsonl",
+		ContentType: "application/x-ndjson",
+		Extension:   "jsonl",
+		Write:       WriteJSONLines,
+	},
+	"xlsx": {
+		Name:        "xlsx",
+		ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		Extension:   "xlsx",
+		Write:       WriteXLSX,
+	},
+}
+
+// header is the column header of the tabular formats
+var header = []string{"subdomain", "ip", "source", "sources"}
+
+// row returns the column values of a subdomain for the tabular formats
+func row(info models.SubdomainInfo) []string {
+	return []string{info.Subdomain, info.IP, info.Source, strings.Join(info.Sources, " ")}
+}
+
+// WriteCSV writes the subdomains as CSV with a header row
+func WriteCSV(w io.Writer, subdomains []models.SubdomainInfo) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, info := range subdomains {
+		if err := writer.Write(row(info)); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteText writes one subdomain per line
+func WriteText(w io.Writer, subdomains []models.SubdomainInfo) error {
+	for _, info := range subdomains {
+		if _, err := fmt.Fprintln(w, info.Subdomain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSONLines writes one JSON object per subdomain per line
+func WriteJSONLines(w io.Writer, subdomains []models.SubdomainInfo) error {
+	encoder := json.NewEncoder(w)
+	for _, info := range subdomains {
+		if err := encoder.Encode(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// sheet is the part of the worksheet XML read by the tests
+type sheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R    string `xml:"r,attr"`
+			T    string `xml:"t,attr"`
+			Text string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func TestWriteXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteXLSX(&buf, []models.SubdomainInfo{
+		{Subdomain: "www.example.com", IP: "192.0.2.1", Source: "crtsh", Sources: []string{"crtsh", "anubis"}},
+		{Subdomain: "=cmd|'/c calc'!A1.example.com", Source: "<crtsh>", Sources: []string{"<crtsh>"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("not a valid zip: %v", err)
+	}
+	parts := make(map[string][]byte)
+	for _, file := range archive.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[file.Name] = data
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		data, ok := parts[name]
+		if !ok {
+			t.Errorf("missing part %s", name)
+			continue
+		}
+		if err := xml.Unmarshal(data, new(struct{})); err != nil {
+			t.Errorf("part %s is not valid XML: %v", name, err)
+		}
+	}
+
+	var got sheet
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &got); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"subdomain", "ip", "source", "sources"},
+		{"www.example.com", "192.0.2.1", "crtsh", "crtsh anubis"},
+		{"=cmd|'/c calc'!A1.example.com", "", "<crtsh>", "<crtsh>"},
+	}
+	if len(got.Rows) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(got.Rows), len(want))
+	}
+	for i, row := range got.Rows {
+		if row.R != i+1 {
+			t.Errorf("row %d numbered %d", i+1, row.R)
+		}
+		var values []string
+		for j, cell := range row.Cells {
+			// Every cell is an inline string, so no value is read as a formula
+			if cell.T != "inlineStr" || cell.R != columnName(j)+string(rune('1'+i)) {
+				t.Errorf("row %d: got cell %s of type %q", i+1, cell.R, cell.T)
+			}
+			values = append(values, cell.Text)
+		}
+		if !reflect.DeepEqual(values, want[i]) {
+			t.Errorf("row %d: got %q, want %q", i+1, values, want[i])
+		}
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for index, want := range map[int]string{0: "A", 3: "D", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(index); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", index, got, want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// namespace prefixes the names of all metrics
+const namespace = "subfinder_service"
+
+// Worker states
+const (
+	WorkerBusy = "busy"
+	WorkerIdle = "idle"
+)
+
+var (
+	// JobsEnqueued counts the jobs added to the queue by priority
+	JobsEnqueued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_enqueued_total",
+		Help:      "Jobs added to the queue, by priority.",
+	}, []string{"priority"})
+
+	// JobsRejected counts the jobs rejected because the queue was full
+	JobsRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_rejected_total",
+		Help:      "Jobs rejected because the queue was full.",
+	})
+
+	// JobDuration observes how long subfinder ran for each job processed by this replica
+	JobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Time subfinder ran for a job, by final status.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+	}, []string{"status"})
+
+	// SubdomainsFound observes the number of subdomains of each completed job
+	SubdomainsFound = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_subdomains_found",
+		Help:      "Subdomains found by a completed job.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 9),
+	})
+
+	// Workers counts the workers of this replica by state
+	Workers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "workers",
+		Help:      "Workers of this replica, by state.",
+	}, []string{"state"})
+
+	// SubfinderRuns counts subfinder runs by client and exit code
+	SubfinderRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "subfinder_runs_total",
+		Help:      "Subfinder runs, by client and exit code. Canceled runs report -1.",
+	}, []string{"client", "exit_code"})
+
+	// DNSLookupDuration observes the latency of resolving a subdomain
+	DNSLookupDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "dns_lookup_duration_seconds",
+		Help:      "Latency of resolving a subdomain, by result.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+	}, []string{"result"})
+)
+
+// ObserveRun records a subfinder run that exited with code
+func ObserveRun(client string, code int) {
+	SubfinderRuns.WithLabelValues(client, strconv.Itoa(code)).Inc()
+}
+
+// ObserveLookup records a DNS lookup that started at start
+func ObserveLookup(start time.Time, err error) {
+	result := "resolved"
+	if err != nil {
+		result = "failed"
+	}
+	DNSLookupDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// Queue is the part of the job queue read when metrics are collected
+type Queue interface {
+	// Len returns the number of queued jobs
+	Len() int
+
+	// Capacity returns the maximum number of queued jobs
+	Capacity() int
+
+	// Summaries returns all stored jobs without their subdomains, log and diff
+	Summaries() []*models.Job
+}
+
+// queueCollector reports the state of the job queue when metrics are collected
+type queueCollector struct {
+	queue    Queue
+	depth    *prometheus.Desc
+	capacity *prometheus.Desc
+	jobs     *prometheus.Desc
+}
+
+// RegisterQueue reports the depth and capacity of a job queue and its jobs by status
+func RegisterQueue(queue Queue) {
+	prometheus.MustRegister(&queueCollector{
+		queue:    queue,
+		depth:    prometheus.NewDesc(namespace+"_queue_depth", "Jobs waiting in the queue.", nil, nil),
+		capacity: prometheus.NewDesc(namespace+"_queue_capacity", "Maximum number of jobs waiting in the queue.", nil, nil),
+		jobs:     prometheus.NewDesc(namespace+"_jobs", "Stored jobs, by status.", []string{"status"}, nil),
+	})
+}
+
+// Describe sends the descriptors of the queue metrics
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.depth
+	ch <- c.capacity
+	ch <- c.jobs
+}
+
+// Collect reads the queue and sends the current values
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.depth, prometheus.GaugeValue, float64(c.queue.Len()))
+	ch <- prometheus.MustNewConstMetric(c.capacity, prometheus.GaugeValue, float64(c.queue.Capacity()))
+
+	counts := map[models.JobStatus]int{
+		models.JobStatusQueued:    0,
+		models.JobStatusRunning:   0,
+		models.JobStatusCompleted: 0,
+		models.JobStatusFailed:    0,
+		models.JobStatusCanceled:  0,
+	}
+	for _, job := range c.queue.Summaries() {
+		counts[job.Status]++
+	}
+	for status, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.jobs, prometheus.GaugeValue, float64(count), string(status))
+	}
+}
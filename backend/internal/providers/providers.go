@@ -0,0 +1,209 @@
+package providers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// Errors
+var (
+	ErrUnknownSource = errors.New("unknown source")
+	ErrKeyNotFound   = errors.New("provider key not found")
+	ErrInvalidKey    = errors.New("invalid provider key")
+)
+
+// Manager keeps the API keys of the passive sources encrypted with AES-256-GCM
+type Manager struct {
+	store   Store
+	aead    cipher.AEAD
+	sources []string
+	mutex   sync.Mutex
+}
+
+// NewManager creates a new provider key manager. secret is the base64-encoded
+// 32-byte encryption key and sources lists the sources that accept keys.
+func NewManager(store Store, secret string, sources []string) (*Manager, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(secret))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("encryption key must be 32 bytes encoded as base64")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manager{
+		store:   store,
+		aead:    aead,
+		sources: sources,
+	}, nil
+}
+
+// List returns the keys of every source that accepts keys, without the encrypted values
+func (m *Manager) List() []models.ProviderSource {
+	bySource := make(map[string][]*models.ProviderKey)
+	for _, key := range m.store.List() {
+		key.Ciphertext = nil
+		bySource[key.Source] = append(bySource[key.Source], key)
+	}
+
+	sources := make([]models.ProviderSource, 0, len(m.sources))
+	for _, source := range m.sources {
+		keys := bySource[source]
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		})
+		if keys == nil {
+			keys = []*models.ProviderKey{}
+		}
+		sources = append(sources, models.ProviderSource{Source: source, Keys: keys})
+	}
+	return sources
+}
+
+// Add encrypts and stores a new key for a source
+func (m *Manager) Add(source, value string) (*models.ProviderKey, error) {
+	source = strings.ToLower(strings.TrimSpace(source))
+	if !m.accepts(source) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownSource, source)
+	}
+
+	key := &models.ProviderKey{
+		ID:        uuid.New().String(),
+		Source:    source,
+		CreatedAt: time.Now(),
+	}
+	if err := m.seal(key, value); err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.store.Save(key); err != nil {
+		return nil, err
+	}
+	key.Ciphertext = nil
+	return key, nil
+}
+
+// Rotate replaces the value of an existing key of a source
+func (m *Manager) Rotate(source, id, value string) (*models.ProviderKey, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key, ok := m.store.Get(id)
+	if !ok || key.Source != strings.ToLower(source) {
+		return nil, ErrKeyNotFound
+	}
+	if err := m.seal(key, value); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	key.RotatedAt = &now
+
+	if err := m.store.Save(key); err != nil {
+		return nil, err
+	}
+	key.Ciphertext = nil
+	return key, nil
+}
+
+// Delete removes a key of a source
+func (m *Manager) Delete(source, id string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	key, ok := m.store.Get(id)
+	if !ok || key.Source != strings.ToLower(source) {
+		return ErrKeyNotFound
+	}
+	return m.store.Delete(id)
+}
+
+// ProviderKeys returns the decrypted keys of every source
+func (m *Manager) ProviderKeys() (map[string][]string, error) {
+	keys := m.store.List()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	values := make(map[string][]string)
+	for _, key := range keys {
+		value, err := m.open(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt provider key %s: %v", key.ID, err)
+		}
+		values[key.Source] = append(values[key.Source], value)
+	}
+	return values, nil
+}
+
+// accepts reports whether source takes API keys
+func (m *Manager) accepts(source string) bool {
+	for _, name := range m.sources {
+		if name == source {
+			return true
+		}
+	}
+	return false
+}
+
+// seal encrypts value into the key. The ID and source are bound to the
+// ciphertext so it cannot be moved to another record.
+func (m *Manager) seal(key *models.ProviderKey, value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.ContainsAny(value, "\r\n") {
+		return ErrInvalidKey
+	}
+
+	nonce := make([]byte, m.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	key.Ciphertext = m.aead.Seal(nonce, nonce, []byte(value), additionalData(key))
+	key.Hint = hint(value)
+	return nil
+}
+
+// open decrypts the value of a key
+func (m *Manager) open(key *models.ProviderKey) (string, error) {
+	size := m.aead.NonceSize()
+	if len(key.Ciphertext) < size {
+		return "", errors.New("ciphertext too short")
+	}
+	plaintext, err := m.aead.Open(nil, key.Ciphertext[:size], key.Ciphertext[size:], additionalData(key))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// additionalData returns the data authenticated along with a key's ciphertext
+func additionalData(key *models.ProviderKey) []byte {
+	return []byte(key.Source + "/" + key.ID)
+}
+
+// hint returns the last characters of a key, or nothing for short keys
+func hint(value string) string {
+	if len(value) < 12 {
+		return ""
+	}
+	return "..." + value[len(value)-4:]
+}
@@ -0,0 +1,214 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/user/subfinder-service/backend/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store persists encrypted provider keys
+type Store interface {
+	// Save inserts or replaces a key
+	Save(key *models.ProviderKey) error
+
+	// Get returns a key by ID
+	Get(id string) (*models.ProviderKey, bool)
+
+	// List returns all stored keys
+	List() []*models.ProviderKey
+
+	// Delete removes a key
+	Delete(id string) error
+}
+
+// MemoryStore keeps provider keys in an in-memory map
+type MemoryStore struct {
+	keys  map[string]*models.ProviderKey
+	mutex sync.RWMutex
+}
+
+// NewMemoryStore creates a new in-memory provider key store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		keys: make(map[string]*models.ProviderKey),
+	}
+}
+
+// Save stores a copy of the key in the map
+func (s *MemoryStore) Save(key *models.ProviderKey) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored := *key
+	s.keys[key.ID] = &stored
+	return nil
+}
+
+// Get returns a copy of a key by ID
+func (s *MemoryStore) Get(id string) (*models.ProviderKey, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *key
+	return &copied, true
+}
+
+// List returns copies of all stored keys
+func (s *MemoryStore) List() []*models.ProviderKey {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	keys := make([]*models.ProviderKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		copied := *key
+		keys = append(keys, &copied)
+	}
+	return keys
+}
+
+// Delete removes a key from the map
+func (s *MemoryStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.keys, id)
+	return nil
+}
+
+// keysBucket is the BoltDB bucket holding JSON-encoded provider keys keyed by ID
+var keysBucket = []byte("provider_keys")
+
+// BoltStore keeps provider keys in the BoltDB file shared with the job store
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore creates a provider key store in an open BoltDB database
+func NewBoltStore(db *bolt.DB) (*BoltStore, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(keysBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize provider key store: %v", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// Save writes the key to the database
+func (s *BoltStore) Save(key *models.ProviderKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode provider key %s: %v", key.ID, err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(keysBucket).Put([]byte(key.ID), data)
+	})
+}
+
+// Get returns a key by ID
+func (s *BoltStore) Get(id string) (*models.ProviderKey, bool) {
+	var key *models.ProviderKey
+	s.db.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(keysBucket).Get([]byte(id)); data != nil {
+			key = decodeKey(data)
+		}
+		return nil
+	})
+
+	return key, key != nil
+}
+
+// List returns all stored keys
+func (s *BoltStore) List() []*models.ProviderKey {
+	var keys []*models.ProviderKey
+	s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(keysBucket).ForEach(func(_, data []byte) error {
+			if key := decodeKey(data); key != nil {
+				keys = append(keys, key)
+			}
+			return nil
+		})
+	})
+
+	return keys
+}
+
+// Delete removes a key from the database
+func (s *BoltStore) Delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(keysBucket).Delete([]byte(id))
+	})
+}
+
+// decodeKey decodes a JSON-encoded key, returning nil for corrupt records
+func decodeKey(data []byte) *models.ProviderKey {
+	var key models.ProviderKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil
+	}
+	return &key
+}
+
+// RedisStore keeps provider keys in a Redis hash shared by all replicas of the service
+type RedisStore struct {
+	client *redis.Client
+	key    string
+}
+
+// NewRedisStore creates a provider key store in the Redis database of the job store, under prefix
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, key: prefix + ":provider_keys"}
+}
+
+// Save writes the key to the hash
+func (s *RedisStore) Save(key *models.ProviderKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode key %s: %v", key.ID, err)
+	}
+
+	return s.client.HSet(context.Background(), s.key, key.ID, data).Err()
+}
+
+// Get returns a key by ID
+func (s *RedisStore) Get(id string) (*models.ProviderKey, bool) {
+	data, err := s.client.HGet(context.Background(), s.key, id).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	key := decodeKey(data)
+	return key, key != nil
+}
+
+// List returns all stored keys
+func (s *RedisStore) List() []*models.ProviderKey {
+	values, err := s.client.HGetAll(context.Background(), s.key).Result()
+	if err != nil {
+		return nil
+	}
+
+	keys := make([]*models.ProviderKey, 0, len(values))
+	for _, data := range values {
+		if key := decodeKey([]byte(data)); key != nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Delete removes a key from the hash
+func (s *RedisStore) Delete(id string) error {
+	return s.client.HDel(context.Background(), s.key, id).Err()
+}
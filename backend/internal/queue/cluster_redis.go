@@ -0,0 +1,403 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// pollInterval bounds how long a worker waits before looking for jobs again
+// in case a wake-up from another replica was lost
+const pollInterval = time.Second
+
+// pushScript adds jobs to their lanes if the lanes can take all of them.
+// KEYS are the lanes; ARGV holds the capacity followed by lane number and
+// job ID pairs.
+var pushScript = redis.NewScript(`
+local total = 0
+for i = 1, #KEYS do
+	total = total + redis.call('LLEN', KEYS[i])
+end
+if total + (#ARGV - 1) / 2 > tonumber(ARGV[1]) then
+	return 0
+end
+for i = 2, #ARGV, 2 do
+	redis.call('RPUSH', KEYS[tonumber(ARGV[i])], ARGV[i + 1])
+end
+return 1
+`)
+
+// popScript takes the job that should start next, choosing the lane like
+// nextLane and updating the starvation counters like advance. KEYS are the
+// lanes followed by the hash of starvation counters; ARGV holds the
+// starvation limit. It returns the job ID and the number of jobs left.
+var popScript = redis.NewScript(`
+local counters = KEYS[#KEYS]
+local count = #KEYS - 1
+local lengths, skipped = {}, {}
+for i = 1, count do
+	lengths[i] = redis.call('LLEN', KEYS[i])
+	skipped[i] = tonumber(redis.call('HGET', counters, i) or '0')
+end
+
+local lane
+for i = 1, count do
+	if lengths[i] > 0 and skipped[i] >= tonumber(ARGV[1]) then
+		lane = i
+		break
+	end
+end
+if not lane then
+	for i = 1, count do
+		if lengths[i] > 0 then
+			lane = i
+			break
+		end
+	end
+end
+if not lane then
+	return false
+end
+
+local id = redis.call('LPOP', KEYS[lane])
+redis.call('HSET', counters, lane, 0)
+for lower = lane + 1, count do
+	if lengths[lower] > 0 then
+		redis.call('HINCRBY', counters, lower, 1)
+	else
+		redis.call('HSET', counters, lower, 0)
+	end
+end
+
+local remaining = 0
+for i = 1, count do
+	remaining = remaining + redis.call('LLEN', KEYS[i])
+end
+return {id, remaining}
+`)
+
+// releaseScript deletes a lease only if it is held by the given replica.
+// KEYS[1] is the lease; ARGV[1] is the replica ID.
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// clusterMessage is published on the notice channel. Ready messages announce
+// new jobs; other messages carry a notice.
+type clusterMessage struct {
+	Origin string  `json:"origin"`
+	Ready  bool    `json:"ready,omitempty"`
+	Notice *Notice `json:"notice,omitempty"`
+}
+
+// RedisCluster shares queued jobs between replicas through Redis lists, one
+// per priority lane, and relays notices over a Redis channel
+type RedisCluster struct {
+	client *redis.Client
+	prefix string
+	id     string
+
+	// Jobs leased by this replica
+	held  map[string]bool
+	mutex sync.Mutex
+
+	// Holds a token while jobs may be waiting, waking one blocked Wait
+	ready chan struct{}
+}
+
+// NewRedisCluster creates a cluster that keeps its keys under prefix. Each
+// call creates a new replica.
+func NewRedisCluster(client *redis.Client, prefix string) *RedisCluster {
+	return &RedisCluster{
+		client: client,
+		prefix: prefix,
+		id:     uuid.New().String(),
+		held:   make(map[string]bool),
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+// Push adds jobs to their lanes if they all fit and wakes the replicas
+func (c *RedisCluster) Push(jobs []*models.Job, capacity int) error {
+	args := make([]interface{}, 0, 1+2*len(jobs))
+	args = append(args, capacity)
+	for _, job := range jobs {
+		args = append(args, laneIndex(job.Priority)+1, job.ID)
+	}
+
+	ctx := context.Background()
+	added, err := pushScript.Run(ctx, c.client, c.laneKeys(), args...).Int()
+	if err != nil {
+		return err
+	}
+	if added == 0 {
+		return ErrQueueFull
+	}
+
+	c.signal()
+	c.publish(clusterMessage{Ready: true})
+	return nil
+}
+
+// Pop takes the next job, if any, and passes the wake-up on to another
+// blocked Wait while jobs remain
+func (c *RedisCluster) Pop() (string, bool, error) {
+	keys := append(c.laneKeys(), c.key("skipped"))
+	result, err := popScript.Run(context.Background(), c.client, keys, starvationLimit).Slice()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	id, _ := result[0].(string)
+	if remaining, _ := result[1].(int64); remaining > 0 {
+		c.signal()
+	}
+	return id, true, nil
+}
+
+// Remove drops a job from its lane
+func (c *RedisCluster) Remove(id string) (bool, error) {
+	ctx := context.Background()
+	var removed []*redis.IntCmd
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range c.laneKeys() {
+			removed = append(removed, pipe.LRem(ctx, key, 0, id))
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, cmd := range removed {
+		if cmd.Val() > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Position returns where a queued job waits, replaying the lane selection on
+// a snapshot of the lanes
+func (c *RedisCluster) Position(id string) (*models.QueueInfo, bool, error) {
+	ctx := context.Background()
+	var ids []*redis.StringSliceCmd
+	var counters *redis.MapStringStringCmd
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range c.laneKeys() {
+			ids = append(ids, pipe.LRange(ctx, key, 0, -1))
+		}
+		counters = pipe.HGetAll(ctx, c.key("skipped"))
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	var snapshot lanes
+	for lane := range snapshot.ids {
+		snapshot.ids[lane] = ids[lane].Val()
+		snapshot.skipped[lane], _ = strconv.Atoi(counters.Val()[strconv.Itoa(lane+1)])
+	}
+
+	lane, position, ok := snapshot.position(id)
+	if !ok {
+		return nil, false, nil
+	}
+	return &models.QueueInfo{Lane: lane, Position: position}, true, nil
+}
+
+// Len returns the number of queued jobs in all lanes
+func (c *RedisCluster) Len() (int, error) {
+	ctx := context.Background()
+	var lengths []*redis.IntCmd
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range c.laneKeys() {
+			lengths = append(lengths, pipe.LLen(ctx, key))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, cmd := range lengths {
+		total += int(cmd.Val())
+	}
+	return total, nil
+}
+
+// Wait blocks until a replica pushes a job, the poll interval passes or ctx is done
+func (c *RedisCluster) Wait(ctx context.Context) error {
+	timer := time.NewTimer(pollInterval)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.ready:
+	case <-timer.C:
+	}
+	return nil
+}
+
+// Run subscribes to the notice channel and renews the leases of held jobs
+// until ctx is done. The client reconnects on its own if Redis goes away.
+func (c *RedisCluster) Run(ctx context.Context, handle func(notice Notice)) {
+	pubsub := c.client.Subscribe(ctx, c.key("notices"))
+	defer pubsub.Close()
+	messages := pubsub.Channel()
+
+	ticker := time.NewTicker(leaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.renew()
+		case raw, ok := <-messages:
+			if !ok {
+				return
+			}
+			var message clusterMessage
+			if err := json.Unmarshal([]byte(raw.Payload), &message); err != nil {
+				continue
+			}
+			if message.Ready {
+				c.signal()
+				continue
+			}
+			if message.Origin != c.id && message.Notice != nil {
+				handle(*message.Notice)
+			}
+		}
+	}
+}
+
+// Broadcast publishes a notice for the other replicas
+func (c *RedisCluster) Broadcast(notice Notice) error {
+	return c.publish(clusterMessage{Notice: &notice})
+}
+
+// Hold leases a job to this replica unless another replica holds it, which
+// happens when a job is dequeued twice and the second worker skips it. A lease
+// that cannot be written now is written when the leases are next renewed.
+func (c *RedisCluster) Hold(id string) {
+	acquired, err := c.client.SetNX(context.Background(), c.leaseKey(id), c.id, leaseTTL).Result()
+	if err == nil && !acquired {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.held[id] = true
+}
+
+// Release removes the lease of a job if this replica holds it
+func (c *RedisCluster) Release(id string) {
+	c.mutex.Lock()
+	held := c.held[id]
+	delete(c.held, id)
+	c.mutex.Unlock()
+
+	if held {
+		releaseScript.Run(context.Background(), c.client, []string{c.leaseKey(id)}, c.id)
+	}
+}
+
+// Held reports which of the jobs are leased by any replica
+func (c *RedisCluster) Held(ids []string) (map[string]bool, error) {
+	ctx := context.Background()
+	exists := make([]*redis.IntCmd, len(ids))
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			exists[i] = pipe.Exists(ctx, c.leaseKey(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	held := make(map[string]bool, len(ids))
+	for i, id := range ids {
+		held[id] = exists[i].Val() > 0
+	}
+	return held, nil
+}
+
+// renew extends the leases of all jobs held by this replica
+func (c *RedisCluster) renew() {
+	c.mutex.Lock()
+	ids := make([]string, 0, len(c.held))
+	for id := range c.held {
+		ids = append(ids, id)
+	}
+	c.mutex.Unlock()
+
+	ctx := context.Background()
+	c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.Set(ctx, c.leaseKey(id), c.id, leaseTTL)
+		}
+		return nil
+	})
+}
+
+// publish sends a message from this replica on the notice channel
+func (c *RedisCluster) publish(message clusterMessage) error {
+	message.Origin = c.id
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return c.client.Publish(context.Background(), c.key("notices"), data).Err()
+}
+
+// signal wakes one blocked Wait of this replica. A pending wake-up is not duplicated.
+func (c *RedisCluster) signal() {
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+}
+
+// laneKeys returns the keys of the lanes from highest to lowest priority
+func (c *RedisCluster) laneKeys() []string {
+	keys := make([]string, 0, laneCount)
+	for _, priority := range lanePriorities {
+		keys = append(keys, c.key("lane", string(priority)))
+	}
+	return keys
+}
+
+// leaseKey returns the key of the lease of a job
+func (c *RedisCluster) leaseKey(id string) string {
+	return c.key("lease", id)
+}
+
+// key joins parts into a key under the cluster prefix
+func (c *RedisCluster) key(parts ...string) string {
+	key := c.prefix
+	for _, part := range parts {
+		key += ":" + part
+	}
+	return key
+}
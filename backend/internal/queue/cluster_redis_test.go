@@ -0,0 +1,195 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// newTestRedis starts an in-process Redis server and returns a job store on it
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *RedisStore) {
+	server := miniredis.RunT(t)
+	return server, newTestRedisStore(t, server)
+}
+
+// newTestRedisStore returns a job store with its own connection to server, like a replica
+func newTestRedisStore(t *testing.T, server *miniredis.Miniredis) *RedisStore {
+	store, err := NewRedisStore("redis://"+server.Addr(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// newTestPriorityJob returns a queued job for domain with the given priority
+func newTestPriorityJob(domain string, priority models.JobPriority) *models.Job {
+	job := newTestJob(domain)
+	job.Priority = priority
+	return job
+}
+
+func TestRedisPushRespectsCapacity(t *testing.T) {
+	_, store := newTestRedis(t)
+	cluster := NewRedisCluster(store.Client(), store.Prefix())
+
+	var jobs []*models.Job
+	for i := 0; i < 3; i++ {
+		jobs = append(jobs, newTestPriorityJob(fmt.Sprintf("%d.example.com", i), models.JobPriorityLow))
+	}
+	if err := cluster.Push(jobs, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	// Jobs that do not all fit are not added, whatever their lanes
+	more := []*models.Job{
+		newTestPriorityJob("high.example.com", models.JobPriorityHigh),
+		newTestPriorityJob("normal.example.com", models.JobPriorityNormal),
+	}
+	if err := cluster.Push(more, 4); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("got %v, want ErrQueueFull", err)
+	}
+	if n, _ := cluster.Len(); n != 3 {
+		t.Fatalf("%d jobs queued, want 3", n)
+	}
+
+	if err := cluster.Push(more[:1], 4); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := cluster.Len(); n != 4 {
+		t.Errorf("%d jobs queued, want 4", n)
+	}
+}
+
+func TestRedisPopMatchesLocalLanes(t *testing.T) {
+	_, store := newTestRedis(t)
+	cluster := NewRedisCluster(store.Client(), store.Prefix())
+	local := newLocalDispatcher()
+
+	// Enough high-priority jobs to starve the lower lanes
+	var jobs []*models.Job
+	for i := 0; i < 10; i++ {
+		jobs = append(jobs, newTestPriorityJob(fmt.Sprintf("high-%d", i), models.JobPriorityHigh))
+	}
+	for i := 0; i < 3; i++ {
+		jobs = append(jobs, newTestPriorityJob(fmt.Sprintf("normal-%d", i), models.JobPriorityNormal))
+		jobs = append(jobs, newTestPriorityJob(fmt.Sprintf("low-%d", i), models.JobPriorityLow))
+	}
+	for _, dispatcher := range []Dispatcher{cluster, local} {
+		if err := dispatcher.Push(jobs, DefaultCapacity); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Positions reported by the script-driven lanes match the start order
+	info, ok, err := cluster.Position("low-0")
+	if err != nil || !ok {
+		t.Fatalf("low-0 not queued: %v", err)
+	}
+	want, _, _ := local.Position("low-0")
+	if *info != *want {
+		t.Errorf("position of low-0 is %+v, want %+v", info, want)
+	}
+
+	for i := range jobs {
+		got, ok, err := cluster.Pop()
+		if err != nil || !ok {
+			t.Fatalf("pop %d: %v", i, err)
+		}
+		expected, _, _ := local.Pop()
+		if got != expected {
+			t.Fatalf("pop %d returned %s, want %s", i, got, expected)
+		}
+	}
+	if _, ok, _ := cluster.Pop(); ok {
+		t.Error("pop from empty lanes returned a job")
+	}
+}
+
+func TestRedisStoreUpdateRetriesConcurrentChanges(t *testing.T) {
+	server, _ := newTestRedis(t)
+	replicas := []*RedisStore{newTestRedisStore(t, server), newTestRedisStore(t, server)}
+	if err := replicas[0].Save(newTestJob("example.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replicas change the job at the same time; no change may be lost
+	const updates = 40
+	var wg sync.WaitGroup
+	for i := 0; i < updates; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := replicas[i%len(replicas)].Update("example.com", func(job *models.Job) error {
+				job.Subdomains = append(job.Subdomains, models.SubdomainInfo{Subdomain: fmt.Sprintf("%d.example.com", i)})
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	job, ok := replicas[1].Get("example.com")
+	if !ok {
+		t.Fatal("job not found")
+	}
+	if len(job.Subdomains) != updates {
+		t.Errorf("job has %d subdomains, want %d", len(job.Subdomains), updates)
+	}
+
+	if _, err := replicas[0].Update("missing", func(*models.Job) error { return nil }); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("update of a missing job: got %v, want ErrJobNotFound", err)
+	}
+}
+
+func TestReapRecoversJobsOfStoppedReplicas(t *testing.T) {
+	server, store := newTestRedis(t)
+	stopped := NewRedisCluster(store.Client(), store.Prefix())
+	q := NewClusterJobQueue(newTestRedisStore(t, server), NewRedisCluster(store.Client(), store.Prefix()), DefaultCapacity)
+
+	// The stopped replica was running one job and had just dequeued and
+	// leased another
+	old := time.Now().Add(-2 * leaseTTL)
+	running := newTestJob("running.example.com")
+	running.Status = models.JobStatusRunning
+	running.StartedAt = &old
+	dequeued := newTestJob("dequeued.example.com")
+	dequeued.CreatedAt = old
+	for _, job := range []*models.Job{running, dequeued} {
+		if err := store.Save(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stopped.Hold(running.ID)
+	stopped.Hold(dequeued.ID)
+
+	// Jobs are left alone while their leases last
+	if requeued, interrupted, err := q.reap(); err != nil || requeued != 0 || interrupted != 0 {
+		t.Fatalf("reap with a live lease: %d requeued, %d interrupted, %v", requeued, interrupted, err)
+	}
+	if job, _ := q.Get(running.ID); job.Status != models.JobStatusRunning {
+		t.Fatalf("leased job has status %s", job.Status)
+	}
+
+	server.FastForward(leaseTTL + time.Second)
+	requeued, interrupted, err := q.reap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requeued != 1 || interrupted != 1 {
+		t.Errorf("%d requeued and %d interrupted, want 1 and 1", requeued, interrupted)
+	}
+	if job, _ := q.Get(running.ID); job.Status != models.JobStatusFailed {
+		t.Errorf("job without a lease has status %s, want failed", job.Status)
+	}
+	if _, queued := q.Position(dequeued.ID); !queued {
+		t.Error("dequeued job was not queued again")
+	}
+}
@@ -0,0 +1,165 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// Dispatcher holds the IDs of queued jobs in their priority lanes and hands
+// them out to the workers
+type Dispatcher interface {
+	// Push adds jobs to the end of their lanes. If the lanes cannot take all
+	// of them without exceeding capacity, none are added and ErrQueueFull is returned.
+	Push(jobs []*models.Job, capacity int) error
+
+	// Pop removes and returns the job that should start next, if any
+	Pop() (string, bool, error)
+
+	// Remove drops a job from its lane, reporting whether it was queued
+	Remove(id string) (bool, error)
+
+	// Position returns the lane of a queued job and its position in the order
+	// queued jobs will be started
+	Position(id string) (*models.QueueInfo, bool, error)
+
+	// Len returns the number of queued jobs
+	Len() (int, error)
+
+	// Wait blocks until jobs may have been pushed or ctx is done
+	Wait(ctx context.Context) error
+}
+
+// Cluster is a Dispatcher shared by several replicas of the service. Besides
+// the queued jobs it relays notices between the replicas and keeps leases on
+// the jobs each replica is processing.
+type Cluster interface {
+	Dispatcher
+
+	// Run passes the notices of other replicas to handle and keeps the leases
+	// of held jobs alive until ctx is done
+	Run(ctx context.Context, handle func(notice Notice))
+
+	// Broadcast sends a notice to the other replicas
+	Broadcast(notice Notice) error
+
+	// Hold takes a lease on a job processed by this replica
+	Hold(id string)
+
+	// Release gives up the lease on a job
+	Release(id string)
+
+	// Held reports which of the jobs are leased by any replica
+	Held(ids []string) (map[string]bool, error)
+}
+
+// Notice types sent between replicas
+const (
+	NoticeEvent  = "event"
+	NoticeCancel = "cancel"
+)
+
+// Notice tells other replicas about an event of a job, or asks the replica
+// running a job to cancel it
+type Notice struct {
+	Type  string `json:"type"`
+	JobID string `json:"job_id"`
+	Event *Event `json:"event,omitempty"`
+}
+
+// leaseTTL is how long a job lease lasts unless renewed. Replicas renew their
+// leases well before they expire, so a job without a lease has been abandoned
+// by a replica that stopped.
+const leaseTTL = 30 * time.Second
+
+// localDispatcher keeps the queued jobs of a single process in memory
+type localDispatcher struct {
+	lanes lanes
+	mutex sync.Mutex
+
+	// Holds a token while jobs may be waiting, waking one blocked Wait
+	ready chan struct{}
+}
+
+// newLocalDispatcher creates an empty in-memory dispatcher
+func newLocalDispatcher() *localDispatcher {
+	return &localDispatcher{
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// Push adds jobs to their lanes if they all fit
+func (d *localDispatcher) Push(jobs []*models.Job, capacity int) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if capacity-d.lanes.len() < len(jobs) {
+		return ErrQueueFull
+	}
+	for _, job := range jobs {
+		d.lanes.push(job.Priority, job.ID)
+	}
+	d.signal()
+	return nil
+}
+
+// Pop takes the next job, if any, and passes the wake-up on to another
+// blocked Wait while jobs remain
+func (d *localDispatcher) Pop() (string, bool, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	id, ok := d.lanes.pop()
+	if d.lanes.len() > 0 {
+		d.signal()
+	}
+	return id, ok, nil
+}
+
+// Remove drops a job from its lane
+func (d *localDispatcher) Remove(id string) (bool, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.lanes.remove(id), nil
+}
+
+// Position returns where a queued job waits
+func (d *localDispatcher) Position(id string) (*models.QueueInfo, bool, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	lane, position, ok := d.lanes.position(id)
+	if !ok {
+		return nil, false, nil
+	}
+	return &models.QueueInfo{Lane: lane, Position: position}, true, nil
+}
+
+// Len returns the number of queued jobs
+func (d *localDispatcher) Len() (int, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.lanes.len(), nil
+}
+
+// Wait blocks until a job is pushed or ctx is done
+func (d *localDispatcher) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-d.ready:
+		return nil
+	}
+}
+
+// signal wakes one blocked Wait. A pending wake-up is not duplicated.
+func (d *localDispatcher) signal() {
+	select {
+	case d.ready <- struct{}{}:
+	default:
+	}
+}
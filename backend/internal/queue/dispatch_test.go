@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// legacyPollInterval is how often idle workers looked for jobs before Dequeue blocked
+const legacyPollInterval = 100 * time.Millisecond
+
+// pollDequeue takes a job the way workers did before Dequeue blocked, waiting
+// between attempts while the queue is empty
+func pollDequeue(q *JobQueue, ctx context.Context) (string, error) {
+	for {
+		if id, ok, _ := q.dispatcher.Pop(); ok {
+			return id, nil
+		}
+		timer := time.NewTimer(legacyPollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return "", ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// BenchmarkDequeueLatency measures the time from Enqueue until one of several
+// idle workers receives the job, with the blocking Dequeue and with the
+// polling it replaced
+func BenchmarkDequeueLatency(b *testing.B) {
+	dequeuers := []struct {
+		name    string
+		dequeue func(q *JobQueue, ctx context.Context) (string, error)
+	}{
+		{"blocking", (*JobQueue).Dequeue},
+		{"polling", pollDequeue},
+	}
+
+	for _, dequeuer := range dequeuers {
+		dequeue := dequeuer.dequeue
+		for _, workers := range []int{1, 5, 20} {
+			b.Run(fmt.Sprintf("%s/workers=%d", dequeuer.name, workers), func(b *testing.B) {
+				q := NewJobQueue(NewMemoryStore(), DefaultCapacity)
+				ctx, cancel := context.WithCancel(context.Background())
+
+				// Stop the workers before the next run starts
+				var wg sync.WaitGroup
+				defer wg.Wait()
+				defer cancel()
+
+				received := make(chan string)
+				for w := 0; w < workers; w++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for {
+							id, err := dequeue(q, ctx)
+							if err != nil {
+								return
+							}
+							select {
+							case received <- id:
+							case <-ctx.Done():
+								return
+							}
+						}
+					}()
+				}
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					job := newTestJob(strconv.Itoa(i))
+					if err := q.Enqueue(job); err != nil {
+						b.Fatal(err)
+					}
+					if id := <-received; id != job.ID {
+						b.Fatalf("dequeued %s, want %s", id, job.ID)
+					}
+				}
+			})
+		}
+	}
+}
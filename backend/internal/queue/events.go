@@ -0,0 +1,116 @@
+package queue
+
+import (
+	"sync"
+
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// Event types published while a job runs
+const (
+	EventSubdomain = "subdomain"
+	EventStatus    = "status"
+)
+
+// Event represents a live update about a job
+type Event struct {
+	// Type of the event, either EventSubdomain or EventStatus
+	Type string `json:"type"`
+
+	// Subdomain found, set for EventSubdomain
+	Subdomain models.SubdomainInfo `json:"subdomain"`
+
+	// New job status, set for EventStatus
+	Status models.JobStatus `json:"status,omitempty"`
+}
+
+// subscriberBuffer is the number of events buffered per subscriber. A
+// subscriber that falls further behind is unsubscribed and its channel closed,
+// so it can read the job again instead of missing events.
+const subscriberBuffer = 256
+
+// Listener is called synchronously for every event of every job and must not block
+type Listener func(id string, event Event)
+
+// broker fans out job events to subscribers
+type broker struct {
+	subscribers map[string]map[chan Event]struct{}
+	listeners   []Listener
+	mutex       sync.Mutex
+}
+
+// newBroker creates a new event broker
+func newBroker() *broker {
+	return &broker{
+		subscribers: make(map[string]map[chan Event]struct{}),
+	}
+}
+
+// subscribe registers a subscriber for the events of a job
+func (b *broker) subscribe(id string) (<-chan Event, func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	if b.subscribers[id] == nil {
+		b.subscribers[id] = make(map[chan Event]struct{})
+	}
+	b.subscribers[id][ch] = struct{}{}
+
+	unsubscribe := func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		b.remove(id, ch)
+	}
+	return ch, unsubscribe
+}
+
+// remove unregisters a subscriber. The caller must hold the mutex.
+func (b *broker) remove(id string, ch chan Event) {
+	delete(b.subscribers[id], ch)
+	if len(b.subscribers[id]) == 0 {
+		delete(b.subscribers, id)
+	}
+}
+
+// listen registers a listener for the events of all jobs
+func (b *broker) listen(listener Listener) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.listeners = append(b.listeners, listener)
+}
+
+// publish sends an event to all listeners and subscribers of a job without blocking
+func (b *broker) publish(id string, event Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, listener := range b.listeners {
+		listener(id, event)
+	}
+	b.send(id, event)
+}
+
+// deliver sends an event published by another replica to the subscribers of
+// a job. Listeners are skipped because the publishing replica already ran them.
+func (b *broker) deliver(id string, event Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.send(id, event)
+}
+
+// send passes an event to the subscribers of a job. Subscribers too slow to
+// take it are dropped and their channels closed. The caller must hold the mutex.
+func (b *broker) send(id string, event Event) {
+	for ch := range b.subscribers[id] {
+		select {
+		case ch <- event:
+		default:
+			b.remove(id, ch)
+			close(ch)
+		}
+	}
+}
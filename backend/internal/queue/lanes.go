@@ -0,0 +1,149 @@
+package queue
+
+import (
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// starvationLimit is the number of jobs started from higher lanes while a
+// lower lane is waiting, after which the lower lane gets the next turn
+const starvationLimit = 4
+
+// lanePriorities lists the lanes from highest to lowest priority
+var lanePriorities = [...]models.JobPriority{
+	models.JobPriorityHigh,
+	models.JobPriorityNormal,
+	models.JobPriorityLow,
+}
+
+// laneCount is the number of lanes
+const laneCount = len(lanePriorities)
+
+// lanes holds the IDs of queued jobs in one FIFO lane per priority. Higher
+// lanes are served first, but a waiting lane is served after it has been
+// passed over starvationLimit times so low-priority work keeps moving.
+type lanes struct {
+	ids     [laneCount][]string
+	skipped [laneCount]int
+}
+
+// laneIndex returns the lane of a priority. Jobs without a known priority use the normal lane.
+func laneIndex(priority models.JobPriority) int {
+	for i, p := range lanePriorities {
+		if p == priority {
+			return i
+		}
+	}
+	return laneIndex(models.JobPriorityNormal)
+}
+
+// len returns the number of queued jobs in all lanes
+func (l *lanes) len() int {
+	total := 0
+	for _, ids := range l.ids {
+		total += len(ids)
+	}
+	return total
+}
+
+// push adds a job to the end of its lane
+func (l *lanes) push(priority models.JobPriority, id string) {
+	i := laneIndex(priority)
+	l.ids[i] = append(l.ids[i], id)
+}
+
+// pop removes and returns the job that should start next
+func (l *lanes) pop() (string, bool) {
+	lengths := l.lengths()
+	lane := nextLane(lengths, l.skipped)
+	if lane < 0 {
+		return "", false
+	}
+
+	id := l.ids[lane][0]
+	l.ids[lane] = l.ids[lane][1:]
+	advance(&l.skipped, lengths, lane)
+	return id, true
+}
+
+// remove drops a job from its lane, reporting whether it was queued
+func (l *lanes) remove(id string) bool {
+	for lane, ids := range l.ids {
+		for i, queued := range ids {
+			if queued == id {
+				l.ids[lane] = append(ids[:i:i], ids[i+1:]...)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// position returns the lane of a queued job and its position, starting at 1,
+// in the order jobs will be started if no other jobs are added
+func (l *lanes) position(id string) (models.JobPriority, int, bool) {
+	target, index := -1, -1
+	for lane, ids := range l.ids {
+		for i, queued := range ids {
+			if queued == id {
+				target, index = lane, i
+			}
+		}
+	}
+	if target < 0 {
+		return "", 0, false
+	}
+
+	// Replay the lane selection on the current lengths until the job comes up
+	lengths := l.lengths()
+	skipped := l.skipped
+	for position := 1; ; position++ {
+		lane := nextLane(lengths, skipped)
+		if lane == target {
+			if index == 0 {
+				return lanePriorities[target], position, true
+			}
+			index--
+		}
+		advance(&skipped, lengths, lane)
+		lengths[lane]--
+	}
+}
+
+// lengths returns the number of jobs in each lane
+func (l *lanes) lengths() [laneCount]int {
+	var lengths [laneCount]int
+	for i, ids := range l.ids {
+		lengths[i] = len(ids)
+	}
+	return lengths
+}
+
+// nextLane returns the lane to serve next, or -1 if all lanes are empty. The
+// highest lane that has been passed over too often wins, otherwise the
+// highest non-empty lane.
+func nextLane(lengths, skipped [laneCount]int) int {
+	for lane := range lengths {
+		if lengths[lane] > 0 && skipped[lane] >= starvationLimit {
+			return lane
+		}
+	}
+	for lane := range lengths {
+		if lengths[lane] > 0 {
+			return lane
+		}
+	}
+	return -1
+}
+
+// advance updates the starvation counters after a job was taken from lane.
+// lengths are the lane lengths before the job was taken.
+func advance(skipped *[laneCount]int, lengths [laneCount]int, lane int) {
+	skipped[lane] = 0
+	for lower := lane + 1; lower < laneCount; lower++ {
+		if lengths[lower] > 0 {
+			skipped[lower]++
+		} else {
+			skipped[lower] = 0
+		}
+	}
+}
@@ -1,98 +1,576 @@
 package queue
 
 import (
+	"context"
+	"errors"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/user/subfinder-service/backend/internal/metrics"
 	"github.com/user/subfinder-service/backend/pkg/models"
 )
 
 // JobQueue represents a queue of jobs to be processed
 type JobQueue struct {
-	jobs     map[string]*models.Job
-	queue    chan string
-	mutex    sync.RWMutex
-	capacity int
+	store      JobStore
+	dispatcher Dispatcher
+	mutex      sync.RWMutex
+	capacity   int
+	cancels    map[string]context.CancelCauseFunc
+	events     *broker
+
+	// Set when the queue is shared with other replicas
+	cluster Cluster
 }
 
-// NewJobQueue creates a new job queue with the specified capacity
-func NewJobQueue() *JobQueue {
+// DefaultCapacity is the number of jobs that can wait in the queue unless configured otherwise
+const DefaultCapacity = 100
+
+// NewJobQueue creates a new job queue backed by the specified store that holds
+// up to capacity waiting jobs
+func NewJobQueue(store JobStore, capacity int) *JobQueue {
 	return &JobQueue{
-		jobs:     make(map[string]*models.Job),
-		queue:    make(chan string, 100), // Buffer size of 100 jobs
-		capacity: 100,
+		store:      store,
+		dispatcher: newLocalDispatcher(),
+		capacity:   capacity,
+		cancels:    make(map[string]context.CancelCauseFunc),
+		events:     newBroker(),
 	}
 }
 
-// Enqueue adds a job to the queue
+// NewClusterJobQueue creates a job queue shared by all replicas that use the
+// same store and cluster. Any replica can enqueue, process, cancel and stream
+// a job. Start must be called to receive notices from the other replicas.
+func NewClusterJobQueue(store JobStore, cluster Cluster, capacity int) *JobQueue {
+	q := NewJobQueue(store, capacity)
+	q.dispatcher = cluster
+	q.cluster = cluster
+	return q
+}
+
+// Start relays events and cancel requests from other replicas and recovers
+// the jobs of replicas that stopped, until ctx is done. It does nothing for a
+// queue that is not shared.
+func (q *JobQueue) Start(ctx context.Context) {
+	if q.cluster == nil {
+		return
+	}
+
+	go q.cluster.Run(ctx, q.receive)
+	go func() {
+		ticker := time.NewTicker(leaseTTL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				q.reap()
+			}
+		}
+	}()
+}
+
+// Enqueue adds a job to the lane of its priority
 func (q *JobQueue) Enqueue(job *models.Job) error {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	// Store the job in the map
-	q.jobs[job.ID] = job
+	// Store the job before queuing it so a worker never dequeues an unknown job
+	if err := q.store.Save(job); err != nil {
+		return err
+	}
 
-	// Add the job ID to the queue
-	select {
-	case q.queue <- job.ID:
-		return nil
-	default:
-		// Queue is full
+	// Add the job ID to its lane, removing the job again if the queue is full
+	// so it does not leave behind a job that will never be picked up
+	if err := q.dispatcher.Push([]*models.Job{job}, q.capacity); err != nil {
+		q.store.Delete(job.ID)
+		if errors.Is(err, ErrQueueFull) {
+			metrics.JobsRejected.Inc()
+		}
+		return err
+	}
+	metrics.JobsEnqueued.WithLabelValues(string(lanePriorities[laneIndex(job.Priority)])).Inc()
+	return nil
+}
+
+// EnqueueBatch stores a batch and adds all of its jobs to the queue. Either
+// all jobs are enqueued or, if the queue cannot hold them all, none are.
+func (q *JobQueue) EnqueueBatch(batch *models.Batch, jobs []*models.Job) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	// Reject the batch before storing it if it obviously does not fit
+	queued, err := q.dispatcher.Len()
+	if err != nil {
+		return err
+	}
+	if q.capacity-queued < len(jobs) {
+		metrics.JobsRejected.Add(float64(len(jobs)))
 		return ErrQueueFull
 	}
+
+	// Remove everything stored so far if the batch cannot be enqueued
+	saved := 0
+	discard := func() {
+		for _, job := range jobs[:saved] {
+			q.store.Delete(job.ID)
+		}
+		q.store.DeleteBatch(batch.ID)
+	}
+
+	for _, job := range jobs {
+		if err := q.store.Save(job); err != nil {
+			discard()
+			return err
+		}
+		saved++
+	}
+	if err := q.store.SaveBatch(batch); err != nil {
+		discard()
+		return err
+	}
+
+	// Another replica may have filled the queue in the meantime
+	if err := q.dispatcher.Push(jobs, q.capacity); err != nil {
+		discard()
+		if errors.Is(err, ErrQueueFull) {
+			metrics.JobsRejected.Add(float64(len(jobs)))
+		}
+		return err
+	}
+	for _, job := range jobs {
+		metrics.JobsEnqueued.WithLabelValues(string(lanePriorities[laneIndex(job.Priority)])).Inc()
+	}
+	return nil
 }
 
-// Dequeue removes a job from the queue and returns it
-func (q *JobQueue) Dequeue() (string, bool) {
-	select {
-	case jobID := <-q.queue:
-		return jobID, true
-	default:
-		// Queue is empty
-		return "", false
+// GetBatch returns a batch by ID
+func (q *JobQueue) GetBatch(id string) (*models.Batch, bool) {
+	return q.store.GetBatch(id)
+}
+
+// DeleteBatch removes a batch and all of its jobs. If any of its jobs is
+// still queued or running nothing is removed.
+func (q *JobQueue) DeleteBatch(id string) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	batch, ok := q.store.GetBatch(id)
+	if !ok {
+		return ErrBatchNotFound
+	}
+	jobs := q.store.GetSummaries(batch.JobIDs)
+	for _, job := range jobs {
+		if !job.Status.IsFinal() {
+			return ErrJobActive
+		}
+	}
+
+	for _, job := range jobs {
+		if err := q.store.Delete(job.ID); err != nil {
+			return err
+		}
+	}
+	return q.store.DeleteBatch(id)
+}
+
+// deleteEmptyBatch removes a batch once none of its jobs are stored
+func (q *JobQueue) deleteEmptyBatch(id string) error {
+	batch, ok := q.store.GetBatch(id)
+	if !ok {
+		return nil
+	}
+	if len(q.store.GetSummaries(batch.JobIDs)) > 0 {
+		return nil
+	}
+	return q.store.DeleteBatch(id)
+}
+
+// Restore re-enqueues jobs that were still queued when the service stopped
+// and marks jobs that were running at that time as failed. It should be
+// called once on startup before the workers are started. A shared queue
+// keeps its queued jobs, so only the jobs abandoned by stopped replicas are
+// recovered.
+func (q *JobQueue) Restore() (requeued int, interrupted int, err error) {
+	if q.cluster != nil {
+		return q.reap()
+	}
+
+	jobs := q.store.Summaries()
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+
+	for _, job := range jobs {
+		switch job.Status {
+		case models.JobStatusQueued:
+			if err := q.dispatcher.Push([]*models.Job{job}, q.capacity); err != nil {
+				// Fail jobs that no longer fit instead of leaving them queued forever
+				if err := q.fail(job, "job could not be re-enqueued after restart: "+err.Error()); err != nil {
+					return requeued, interrupted, err
+				}
+				interrupted++
+				continue
+			}
+			requeued++
+		case models.JobStatusRunning:
+			if err := q.fail(job, "job was interrupted by a service restart"); err != nil {
+				return requeued, interrupted, err
+			}
+			interrupted++
+		}
+	}
+
+	return requeued, interrupted, nil
+}
+
+// reap recovers the jobs of replicas that stopped. Running jobs without a
+// lease are marked as failed; queued jobs that are neither waiting in a lane
+// nor leased, because a replica stopped right after dequeuing them, are
+// queued again.
+func (q *JobQueue) reap() (requeued int, interrupted int, err error) {
+	var abandoned []*models.Job
+	for _, job := range q.store.Summaries() {
+		switch job.Status {
+		case models.JobStatusRunning:
+			abandoned = append(abandoned, job)
+		case models.JobStatusQueued:
+			// Give new jobs time to reach their lane
+			if time.Since(job.CreatedAt) < leaseTTL {
+				continue
+			}
+			_, queued, err := q.dispatcher.Position(job.ID)
+			if err != nil {
+				return requeued, interrupted, err
+			}
+			if !queued {
+				abandoned = append(abandoned, job)
+			}
+		}
+	}
+	if len(abandoned) == 0 {
+		return 0, 0, nil
+	}
+
+	ids := make([]string, len(abandoned))
+	for i, job := range abandoned {
+		ids[i] = job.ID
+	}
+	held, err := q.cluster.Held(ids)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, job := range abandoned {
+		if held[job.ID] {
+			continue
+		}
+
+		message := "job was interrupted because the replica running it stopped"
+		if job.Status == models.JobStatusQueued {
+			// A job dequeued twice is skipped by the second worker, so this is safe
+			// even if the job has just been dequeued
+			err := q.dispatcher.Push([]*models.Job{job}, q.capacity)
+			if err == nil {
+				requeued++
+				continue
+			}
+			message = "job could not be re-enqueued after a replica stopped: " + err.Error()
+		}
+
+		err := q.fail(job, message)
+		if errors.Is(err, ErrJobFinished) || errors.Is(err, ErrJobNotFound) {
+			continue
+		}
+		if err != nil {
+			return requeued, interrupted, err
+		}
+		interrupted++
+	}
+
+	return requeued, interrupted, nil
+}
+
+// fail marks a job that has not finished yet as failed with the given message
+// and publishes its final status
+func (q *JobQueue) fail(job *models.Job, message string) error {
+	_, err := q.Update(job.ID, func(job *models.Job) error {
+		if job.Status.IsFinal() {
+			return ErrJobFinished
+		}
+		now := time.Now()
+		job.Status = models.JobStatusFailed
+		job.Error = message
+		job.CompletedAt = &now
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	q.Publish(job.ID, Event{Type: EventStatus, Status: models.JobStatusFailed})
+	return nil
+}
+
+// Dequeue removes the job that should start next from the queue and returns
+// it, blocking until a job is available. It returns the context error once ctx
+// is done.
+func (q *JobQueue) Dequeue(ctx context.Context) (string, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		// Errors of a shared dispatcher are retried after the next wake-up
+		if id, ok, err := q.dispatcher.Pop(); err == nil && ok {
+			return id, nil
+		}
+
+		if err := q.dispatcher.Wait(ctx); err != nil {
+			return "", err
+		}
+	}
+}
+
+// Position returns the lane of a queued job and its position in the order
+// queued jobs will be started
+func (q *JobQueue) Position(id string) (*models.QueueInfo, bool) {
+	info, ok, err := q.dispatcher.Position(id)
+	if err != nil {
+		return nil, false
 	}
+	return info, ok
 }
 
-// Get returns a job by ID
+// Get returns a copy of a job by ID. Changes to the copy are not stored; use Update instead.
 func (q *JobQueue) Get(id string) (*models.Job, bool) {
+	return q.store.Get(id)
+}
+
+// Update applies fn to the current state of a job and stores the result. No
+// other update can interleave with fn. If fn returns an error the job is left
+// unchanged and the error is returned. On success a copy of the updated job
+// is returned. Stores shared between replicas may call fn more than once.
+func (q *JobQueue) Update(id string, fn func(job *models.Job) error) (*models.Job, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if updater, ok := q.store.(Updater); ok {
+		return updater.Update(id, fn)
+	}
+
+	job, ok := q.store.Get(id)
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	if err := fn(job); err != nil {
+		return nil, err
+	}
+	if err := q.store.Save(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Track registers the cancel function of a running job so that Cancel can stop it
+func (q *JobQueue) Track(id string, cancel context.CancelCauseFunc) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.cancels[id] = cancel
+	if q.cluster != nil {
+		q.cluster.Hold(id)
+	}
+}
+
+// Untrack removes the cancel function of a job that is no longer running
+func (q *JobQueue) Untrack(id string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	delete(q.cancels, id)
+	if q.cluster != nil {
+		q.cluster.Release(id)
+	}
+}
+
+// errJobRunning reports that a job must be stopped by the worker running it
+var errJobRunning = errors.New("job is running")
+
+// Cancel stops a job. Queued jobs are marked as canceled and skipped by the
+// workers; running jobs have their context canceled with ErrJobCanceled and
+// are marked as canceled by the worker once subfinder exits.
+func (q *JobQueue) Cancel(id string) (*models.Job, error) {
+	job, err := q.Update(id, func(job *models.Job) error {
+		switch job.Status {
+		case models.JobStatusQueued:
+			now := time.Now()
+			job.Status = models.JobStatusCanceled
+			job.Error = ErrJobCanceled.Error()
+			job.CompletedAt = &now
+			return nil
+		case models.JobStatusRunning:
+			return errJobRunning
+		default:
+			return ErrJobFinished
+		}
+	})
+	if errors.Is(err, errJobRunning) {
+		return q.stop(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Workers skip canceled jobs, so a failure to remove it only wastes a dequeue
+	q.dispatcher.Remove(id)
+	q.Publish(id, Event{Type: EventStatus, Status: job.Status})
+	return job, nil
+}
+
+// stop cancels the context of a running job. A job that is not running in
+// this process is stopped by the replica running it, if any.
+func (q *JobQueue) stop(id string) (*models.Job, error) {
 	q.mutex.RLock()
-	defer q.mutex.RUnlock()
+	cancel, ok := q.cancels[id]
+	q.mutex.RUnlock()
+
+	switch {
+	case ok:
+		cancel(ErrJobCanceled)
+	case q.cluster != nil:
+		if err := q.cluster.Broadcast(Notice{Type: NoticeCancel, JobID: id}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrJobFinished
+	}
 
-	job, ok := q.jobs[id]
-	return job, ok
+	job, ok := q.store.Get(id)
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// receive handles a notice from another replica
+func (q *JobQueue) receive(notice Notice) {
+	switch notice.Type {
+	case NoticeEvent:
+		if notice.Event != nil {
+			q.events.deliver(notice.JobID, *notice.Event)
+		}
+	case NoticeCancel:
+		q.mutex.RLock()
+		cancel, ok := q.cancels[notice.JobID]
+		q.mutex.RUnlock()
+		if ok {
+			cancel(ErrJobCanceled)
+		}
+	}
 }
 
-// Update updates a job in the queue
-func (q *JobQueue) Update(job *models.Job) {
+// Delete removes a finished job. Queued and running jobs must be canceled
+// first. A batch is removed together with the last of its jobs.
+func (q *JobQueue) Delete(id string) error {
 	q.mutex.Lock()
 	defer q.mutex.Unlock()
 
-	q.jobs[job.ID] = job
+	summaries := q.store.GetSummaries([]string{id})
+	if len(summaries) == 0 {
+		return ErrJobNotFound
+	}
+	job := summaries[0]
+	if !job.Status.IsFinal() {
+		return ErrJobActive
+	}
+	if err := q.store.Delete(id); err != nil {
+		return err
+	}
+
+	if job.BatchID != "" {
+		return q.deleteEmptyBatch(job.BatchID)
+	}
+	return nil
+}
+
+// Subscribe returns a channel receiving live events for a job and a function
+// that must be called to stop receiving them. The channel is closed if the
+// subscriber falls too far behind; the events missed from then on must be
+// recovered by reading the job.
+func (q *JobQueue) Subscribe(id string) (<-chan Event, func()) {
+	return q.events.subscribe(id)
 }
 
-// Size returns the number of jobs in the queue
+// Listen registers a listener that receives the events of all jobs
+func (q *JobQueue) Listen(listener Listener) {
+	q.events.listen(listener)
+}
+
+// Publish sends an event to all subscribers of a job. Listeners only receive
+// the events published by this replica; subscribers receive those of all replicas.
+func (q *JobQueue) Publish(id string, event Event) {
+	q.events.publish(id, event)
+	if q.cluster != nil {
+		// Live events are best effort, like events dropped for slow subscribers
+		q.cluster.Broadcast(Notice{Type: NoticeEvent, JobID: id, Event: &event})
+	}
+}
+
+// Size returns the number of jobs in the store
 func (q *JobQueue) Size() int {
-	q.mutex.RLock()
-	defer q.mutex.RUnlock()
+	return len(q.store.Summaries())
+}
+
+// Len returns the number of jobs waiting in the queue, or 0 if the queue cannot be read
+func (q *JobQueue) Len() int {
+	queued, err := q.dispatcher.Len()
+	if err != nil {
+		return 0
+	}
+	return queued
+}
 
-	return len(q.jobs)
+// Capacity returns the maximum number of jobs waiting in the queue
+func (q *JobQueue) Capacity() int {
+	return q.capacity
 }
 
 // List returns a list of all jobs
 func (q *JobQueue) List() []*models.Job {
-	q.mutex.RLock()
-	defer q.mutex.RUnlock()
+	return q.store.List()
+}
 
-	jobs := make([]*models.Job, 0, len(q.jobs))
-	for _, job := range q.jobs {
-		jobs = append(jobs, job)
-	}
+// Summaries returns all jobs without their subdomains, log and diff
+func (q *JobQueue) Summaries() []*models.Job {
+	return q.store.Summaries()
+}
+
+// GetSummaries returns the jobs among ids without their subdomains, log and
+// diff, skipping jobs that do not exist
+func (q *JobQueue) GetSummaries(ids []string) []*models.Job {
+	return q.store.GetSummaries(ids)
+}
 
-	return jobs
+// ActiveJobs returns the number of queued and running jobs submitted with an API key
+func (q *JobQueue) ActiveJobs(keyID string) int {
+	active := 0
+	for _, job := range q.store.Summaries() {
+		if job.APIKeyID == keyID && !job.Status.IsFinal() {
+			active++
+		}
+	}
+	return active
 }
 
 // Errors
 var (
-	ErrQueueFull = NewError("queue is full")
+	ErrQueueFull     = NewError("queue is full")
+	ErrJobNotFound   = NewError("job not found")
+	ErrBatchNotFound = NewError("batch not found")
+	ErrJobFinished   = NewError("job has already finished")
+	ErrJobCanceled   = NewError("job canceled by user")
+	ErrJobActive     = NewError("job is still queued or running")
 )
 
 // Error represents an error in the queue
@@ -0,0 +1,517 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// newTestJob returns a queued job for domain
+func newTestJob(domain string) *models.Job {
+	return &models.Job{
+		ID:        domain,
+		Domain:    domain,
+		Status:    models.JobStatusQueued,
+		CreatedAt: time.Now(),
+		Priority:  models.JobPriorityNormal,
+	}
+}
+
+// testStores returns a fresh store of every kind that runs in-process
+func testStores(t *testing.T) map[string]JobStore {
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bolt.Close() })
+
+	return map[string]JobStore{
+		"memory": NewMemoryStore(),
+		"bolt":   bolt,
+	}
+}
+
+// process runs a job like a worker: it is skipped unless still queued, then
+// marked as running, given results and completed
+func process(q *JobQueue, id string) error {
+	_, err := q.Update(id, func(job *models.Job) error {
+		if job.Status != models.JobStatusQueued {
+			return ErrJobFinished
+		}
+		now := time.Now()
+		job.Status = models.JobStatusRunning
+		job.StartedAt = &now
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err := q.Update(id, func(job *models.Job) error {
+			job.Subdomains = append(job.Subdomains, models.SubdomainInfo{Subdomain: fmt.Sprintf("%d.%s", i, job.Domain)})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	job, err := q.Update(id, func(job *models.Job) error {
+		now := time.Now()
+		job.Status = models.JobStatusCompleted
+		job.CompletedAt = &now
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	q.Publish(id, Event{Type: EventStatus, Status: job.Status})
+	return nil
+}
+
+func TestConcurrentSubmitProcessRead(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			const (
+				submitters = 4
+				perSubmit  = 25
+				workers    = 4
+				total      = submitters * perSubmit
+			)
+			q := NewJobQueue(store, total)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Workers process jobs until the test is done
+			var processed sync.WaitGroup
+			processed.Add(workers)
+			for w := 0; w < workers; w++ {
+				go func() {
+					defer processed.Done()
+					for {
+						id, err := q.Dequeue(ctx)
+						if err != nil {
+							return
+						}
+						if err := process(q, id); err != nil && !errors.Is(err, ErrJobFinished) {
+							t.Errorf("process %s: %v", id, err)
+						}
+					}
+				}()
+			}
+
+			// Submit jobs while readers and cancelers work on them
+			var wg sync.WaitGroup
+			for s := 0; s < submitters; s++ {
+				wg.Add(1)
+				go func(s int) {
+					defer wg.Done()
+					for i := 0; i < perSubmit; i++ {
+						if err := q.Enqueue(newTestJob(fmt.Sprintf("job-%d-%d.example.com", s, i))); err != nil {
+							t.Errorf("enqueue: %v", err)
+						}
+					}
+				}(s)
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < total; i++ {
+					for _, job := range q.List() {
+						q.Get(job.ID)
+						q.Position(job.ID)
+					}
+				}
+			}()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < perSubmit; i++ {
+					_, err := q.Cancel(fmt.Sprintf("job-0-%d.example.com", i))
+					if err != nil && !errors.Is(err, ErrJobNotFound) && !errors.Is(err, ErrJobFinished) {
+						t.Errorf("cancel: %v", err)
+					}
+				}
+			}()
+			wg.Wait()
+
+			// Every job ends up finished exactly once
+			deadline := time.Now().Add(10 * time.Second)
+			for {
+				finished := 0
+				for _, job := range q.List() {
+					if job.Status.IsFinal() {
+						finished++
+					}
+				}
+				if finished == total {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("%d of %d jobs finished", finished, total)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			cancel()
+			processed.Wait()
+
+			for _, job := range q.List() {
+				switch job.Status {
+				case models.JobStatusCompleted:
+					if len(job.Subdomains) != 3 {
+						t.Errorf("job %s has %d subdomains, want 3", job.ID, len(job.Subdomains))
+					}
+				case models.JobStatusCanceled:
+					if job.StartedAt != nil {
+						t.Errorf("canceled job %s was started", job.ID)
+					}
+				default:
+					t.Errorf("job %s has status %s", job.ID, job.Status)
+				}
+			}
+			if n := q.Len(); n != 0 {
+				t.Errorf("%d jobs left in the queue", n)
+			}
+		})
+	}
+}
+
+func TestConcurrentUpdatesAreNotLost(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			q := NewJobQueue(store, DefaultCapacity)
+			if err := q.Enqueue(newTestJob("example.com")); err != nil {
+				t.Fatal(err)
+			}
+
+			const updates = 50
+			var wg sync.WaitGroup
+			for i := 0; i < updates; i++ {
+				wg.Add(2)
+				go func(i int) {
+					defer wg.Done()
+					_, err := q.Update("example.com", func(job *models.Job) error {
+						job.Subdomains = append(job.Subdomains, models.SubdomainInfo{Subdomain: fmt.Sprintf("%d.example.com", i)})
+						return nil
+					})
+					if err != nil {
+						t.Error(err)
+					}
+				}(i)
+				go func() {
+					defer wg.Done()
+					q.Get("example.com")
+				}()
+			}
+			wg.Wait()
+
+			job, ok := q.Get("example.com")
+			if !ok {
+				t.Fatal("job not found")
+			}
+			if len(job.Subdomains) != updates {
+				t.Errorf("job has %d subdomains, want %d", len(job.Subdomains), updates)
+			}
+		})
+	}
+}
+
+func TestGetReturnsCopy(t *testing.T) {
+	q := NewJobQueue(NewMemoryStore(), DefaultCapacity)
+	if err := q.Enqueue(newTestJob("example.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	job, _ := q.Get("example.com")
+	job.Status = models.JobStatusFailed
+	job.Subdomains = append(job.Subdomains, models.SubdomainInfo{Subdomain: "www.example.com"})
+
+	stored, _ := q.Get("example.com")
+	if stored.Status != models.JobStatusQueued || len(stored.Subdomains) != 0 {
+		t.Errorf("changing a copy changed the stored job: %+v", stored)
+	}
+}
+
+func TestSummariesFollowStoredJobs(t *testing.T) {
+	stores := testStores(t)
+	_, stores["redis"] = newTestRedis(t)
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			q := NewJobQueue(store, DefaultCapacity)
+			for _, domain := range []string{"example.com", "example.org"} {
+				if err := q.Enqueue(newTestJob(domain)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err := q.Update("example.com", func(job *models.Job) error {
+				job.Status = models.JobStatusCompleted
+				job.Subdomains = []models.SubdomainInfo{{Subdomain: "www.example.com"}}
+				job.Log = []string{"done"}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := q.Cancel("example.org"); err != nil {
+				t.Fatal(err)
+			}
+			if err := q.Delete("example.org"); err != nil {
+				t.Fatal(err)
+			}
+
+			summaries := q.Summaries()
+			if len(summaries) != 1 {
+				t.Fatalf("%d summaries, want 1", len(summaries))
+			}
+			summary := summaries[0]
+			if summary.ID != "example.com" || summary.Status != models.JobStatusCompleted {
+				t.Errorf("summary %s has status %s, want example.com completed", summary.ID, summary.Status)
+			}
+			if summary.Subdomains != nil || summary.Log != nil {
+				t.Errorf("summary kept the results of the job: %+v", summary)
+			}
+
+			// Deleted jobs are skipped when looking summaries up by ID
+			found := q.GetSummaries([]string{"example.org", "example.com"})
+			if len(found) != 1 || found[0].ID != "example.com" || found[0].Subdomains != nil {
+				t.Errorf("got summaries %+v, want only example.com", found)
+			}
+		})
+	}
+}
+
+// failingStore fails to save jobs once it has saved the given number of them
+type failingStore struct {
+	JobStore
+	saves int
+}
+
+// Save implements JobStore
+func (s *failingStore) Save(job *models.Job) error {
+	if s.saves == 0 {
+		return errors.New("disk full")
+	}
+	s.saves--
+	return s.JobStore.Save(job)
+}
+
+// fullDispatcher reports free room but rejects every push, like a queue
+// filled by another replica in the meantime
+type fullDispatcher struct {
+	Dispatcher
+}
+
+// Push implements Dispatcher
+func (fullDispatcher) Push([]*models.Job, int) error {
+	return ErrQueueFull
+}
+
+func TestEnqueueBatchLeavesNothingBehindOnFailure(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(q *JobQueue)
+		want  error
+	}{
+		{
+			name:  "job not saved",
+			setup: func(q *JobQueue) { q.store = &failingStore{JobStore: q.store, saves: 2} },
+		},
+		{
+			name:  "queue filled in the meantime",
+			setup: func(q *JobQueue) { q.dispatcher = fullDispatcher{q.dispatcher} },
+			want:  ErrQueueFull,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			q := NewJobQueue(store, DefaultCapacity)
+			test.setup(q)
+
+			batch := &models.Batch{ID: "batch"}
+			var jobs []*models.Job
+			for i := 0; i < 5; i++ {
+				job := newTestJob(fmt.Sprintf("%d.example.com", i))
+				job.BatchID = batch.ID
+				jobs = append(jobs, job)
+				batch.JobIDs = append(batch.JobIDs, job.ID)
+			}
+
+			err := q.EnqueueBatch(batch, jobs)
+			if err == nil || (test.want != nil && !errors.Is(err, test.want)) {
+				t.Fatalf("got %v, want %v", err, test.want)
+			}
+			if n := len(store.List()); n != 0 {
+				t.Errorf("%d jobs left in the store", n)
+			}
+			if _, ok := store.GetBatch(batch.ID); ok {
+				t.Error("batch left in the store")
+			}
+		})
+	}
+}
+
+// enqueueTestBatch enqueues a batch with a job for each domain
+func enqueueTestBatch(t *testing.T, q *JobQueue, id string, domains ...string) {
+	t.Helper()
+	batch := &models.Batch{ID: id, Domains: domains}
+	var jobs []*models.Job
+	for _, domain := range domains {
+		job := newTestJob(domain)
+		job.BatchID = id
+		jobs = append(jobs, job)
+		batch.JobIDs = append(batch.JobIDs, job.ID)
+	}
+	if err := q.EnqueueBatch(batch, jobs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteRemovesBatchWithItsLastJob(t *testing.T) {
+	q := NewJobQueue(NewMemoryStore(), DefaultCapacity)
+	enqueueTestBatch(t, q, "batch", "a.example.com", "b.example.com")
+	for _, id := range []string{"a.example.com", "b.example.com"} {
+		if _, err := q.Cancel(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := q.Delete("a.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := q.GetBatch("batch"); !ok {
+		t.Fatal("batch removed while it still has jobs")
+	}
+	if err := q.Delete("b.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := q.GetBatch("batch"); ok {
+		t.Error("batch kept after its last job was deleted")
+	}
+}
+
+func TestDeleteBatchRemovesFinishedJobs(t *testing.T) {
+	q := NewJobQueue(NewMemoryStore(), DefaultCapacity)
+	enqueueTestBatch(t, q, "batch", "a.example.com", "b.example.com")
+	if _, err := q.Cancel("a.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is removed while a job is still queued
+	if err := q.DeleteBatch("batch"); !errors.Is(err, ErrJobActive) {
+		t.Fatalf("got %v, want ErrJobActive", err)
+	}
+	if _, ok := q.Get("a.example.com"); !ok {
+		t.Fatal("finished job removed although the batch was not")
+	}
+
+	if _, err := q.Cancel("b.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.DeleteBatch("batch"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(q.List()); n != 0 {
+		t.Errorf("%d jobs left", n)
+	}
+	if err := q.DeleteBatch("batch"); !errors.Is(err, ErrBatchNotFound) {
+		t.Errorf("second delete: got %v, want ErrBatchNotFound", err)
+	}
+}
+
+func TestCancelQueuedJob(t *testing.T) {
+	q := NewJobQueue(NewMemoryStore(), DefaultCapacity)
+	if err := q.Enqueue(newTestJob("example.com")); err != nil {
+		t.Fatal(err)
+	}
+	events, unsubscribe := q.Subscribe("example.com")
+	defer unsubscribe()
+
+	job, err := q.Cancel("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != models.JobStatusCanceled {
+		t.Errorf("status %s, want canceled", job.Status)
+	}
+	if event := <-events; event.Type != EventStatus || event.Status != models.JobStatusCanceled {
+		t.Errorf("got event %+v, want canceled status", event)
+	}
+	if n := q.Len(); n != 0 {
+		t.Errorf("canceled job is still queued")
+	}
+	if _, err := q.Cancel("example.com"); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("second cancel: got %v, want ErrJobFinished", err)
+	}
+}
+
+func TestDequeueStopsWithContext(t *testing.T) {
+	q := NewJobQueue(NewMemoryStore(), DefaultCapacity)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if _, err := q.Dequeue(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestSlowSubscriberIsClosed(t *testing.T) {
+	q := NewJobQueue(NewMemoryStore(), DefaultCapacity)
+	events, unsubscribe := q.Subscribe("example.com")
+	defer unsubscribe()
+	others, unsubscribeOthers := q.Subscribe("example.org")
+	defer unsubscribeOthers()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		q.Publish("example.com", Event{Type: EventSubdomain, Subdomain: models.SubdomainInfo{Subdomain: fmt.Sprintf("%d.example.com", i)}})
+	}
+	q.Publish("example.com", Event{Type: EventStatus, Status: models.JobStatusCompleted})
+
+	// The buffered events are kept, then the channel is closed instead of
+	// silently losing the rest, including the final status
+	received := 0
+	for range events {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("received %d events before the channel was closed, want %d", received, subscriberBuffer)
+	}
+
+	// Subscribers of other jobs are not affected
+	q.Publish("example.org", Event{Type: EventStatus, Status: models.JobStatusCompleted})
+	if event := <-others; event.Status != models.JobStatusCompleted {
+		t.Errorf("got event %+v, want completed status", event)
+	}
+}
+
+func TestRestorePublishesInterruptedJobs(t *testing.T) {
+	store := NewMemoryStore()
+	running := newTestJob("example.com")
+	running.Status = models.JobStatusRunning
+	if err := store.Save(running); err != nil {
+		t.Fatal(err)
+	}
+
+	// Listeners such as the webhook notifier learn that the job failed
+	q := NewJobQueue(store, DefaultCapacity)
+	var events []Event
+	q.Listen(func(id string, event Event) {
+		if id == running.ID {
+			events = append(events, event)
+		}
+	})
+	if _, interrupted, err := q.Restore(); err != nil || interrupted != 1 {
+		t.Fatalf("restore: %d interrupted, %v", interrupted, err)
+	}
+	if len(events) != 1 || events[0].Type != EventStatus || events[0].Status != models.JobStatusFailed {
+		t.Errorf("got events %+v, want one failed status", events)
+	}
+}
@@ -0,0 +1,170 @@
+package queue
+
+import (
+	"sync"
+
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// JobStore persists jobs independently of the pending queue. Jobs passed to
+// and returned from a store are copies, so callers may keep and modify them.
+type JobStore interface {
+	// Save inserts or replaces a job
+	Save(job *models.Job) error
+
+	// Get returns a job by ID
+	Get(id string) (*models.Job, bool)
+
+	// List returns all stored jobs
+	List() []*models.Job
+
+	// Summaries returns all stored jobs without their subdomains, log and diff
+	Summaries() []*models.Job
+
+	// GetSummaries returns the stored jobs among ids without their
+	// subdomains, log and diff, skipping IDs that are not stored
+	GetSummaries(ids []string) []*models.Job
+
+	// Delete removes a job
+	Delete(id string) error
+
+	// SaveBatch inserts or replaces a batch
+	SaveBatch(batch *models.Batch) error
+
+	// GetBatch returns a batch by ID
+	GetBatch(id string) (*models.Batch, bool)
+
+	// DeleteBatch removes a batch
+	DeleteBatch(id string) error
+
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// Updater is implemented by stores shared between processes. Update applies
+// fn to the stored job atomically and may call fn more than once if another
+// process changes the job concurrently.
+type Updater interface {
+	Update(id string, fn func(job *models.Job) error) (*models.Job, error)
+}
+
+// MemoryStore keeps jobs in an in-memory map. Jobs are lost when the process exits.
+type MemoryStore struct {
+	jobs    map[string]*models.Job
+	batches map[string]*models.Batch
+	mutex   sync.RWMutex
+}
+
+// NewMemoryStore creates a new in-memory job store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		jobs:    make(map[string]*models.Job),
+		batches: make(map[string]*models.Batch),
+	}
+}
+
+// Save stores a copy of the job in the map
+func (s *MemoryStore) Save(job *models.Job) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.jobs[job.ID] = job.Clone()
+	return nil
+}
+
+// Get returns a copy of a job by ID
+func (s *MemoryStore) Get(id string) (*models.Job, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	return job.Clone(), true
+}
+
+// List returns copies of all stored jobs
+func (s *MemoryStore) List() []*models.Job {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	jobs := make([]*models.Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.Clone())
+	}
+
+	return jobs
+}
+
+// Summaries returns summaries of all stored jobs
+func (s *MemoryStore) Summaries() []*models.Job {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	jobs := make([]*models.Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.Summary())
+	}
+
+	return jobs
+}
+
+// GetSummaries returns summaries of the stored jobs among ids
+func (s *MemoryStore) GetSummaries(ids []string) []*models.Job {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	jobs := make([]*models.Job, 0, len(ids))
+	for _, id := range ids {
+		if job, ok := s.jobs[id]; ok {
+			jobs = append(jobs, job.Summary())
+		}
+	}
+
+	return jobs
+}
+
+// Delete removes a job from the map
+func (s *MemoryStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.jobs, id)
+	return nil
+}
+
+// SaveBatch stores a copy of the batch in the map
+func (s *MemoryStore) SaveBatch(batch *models.Batch) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.batches[batch.ID] = batch.Clone()
+	return nil
+}
+
+// GetBatch returns a copy of a batch by ID
+func (s *MemoryStore) GetBatch(id string) (*models.Batch, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	batch, ok := s.batches[id]
+	if !ok {
+		return nil, false
+	}
+	return batch.Clone(), true
+}
+
+// DeleteBatch removes a batch from the map
+func (s *MemoryStore) DeleteBatch(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.batches, id)
+	return nil
+}
+
+// Close is a no-op for the in-memory store
+func (s *MemoryStore) Close() error {
+	return nil
+}
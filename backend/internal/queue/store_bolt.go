@@ -0,0 +1,209 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/user/subfinder-service/backend/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltDB buckets holding JSON-encoded jobs, job summaries and batches keyed by ID
+var (
+	jobsBucket      = []byte("jobs")
+	summariesBucket = []byte("job_summaries")
+	batchesBucket   = []byte("batches")
+)
+
+// BoltStore keeps jobs in an embedded BoltDB file so they survive restarts
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens (or creates) the BoltDB file at path
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job store %s: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{jobsBucket, batchesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket(summariesBucket) != nil {
+			return nil
+		}
+
+		// Summarize the jobs of files written before summaries were kept
+		summaries, err := tx.CreateBucket(summariesBucket)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(jobsBucket).ForEach(func(id, data []byte) error {
+			job := decodeJob(data)
+			if job == nil {
+				return nil
+			}
+			summary, err := json.Marshal(job.Summary())
+			if err != nil {
+				return err
+			}
+			return summaries.Put(id, summary)
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize job store %s: %v", path, err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// Save writes the job and its summary to the database
+func (s *BoltStore) Save(job *models.Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job %s: %v", job.ID, err)
+	}
+	summary, err := json.Marshal(job.Summary())
+	if err != nil {
+		return fmt.Errorf("failed to encode job %s: %v", job.ID, err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(jobsBucket).Put([]byte(job.ID), data); err != nil {
+			return err
+		}
+		return tx.Bucket(summariesBucket).Put([]byte(job.ID), summary)
+	})
+}
+
+// Get returns a job by ID
+func (s *BoltStore) Get(id string) (*models.Job, bool) {
+	var job *models.Job
+	s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		job = decodeJob(data)
+		return nil
+	})
+
+	return job, job != nil
+}
+
+// List returns all stored jobs
+func (s *BoltStore) List() []*models.Job {
+	return s.list(jobsBucket)
+}
+
+// Summaries returns summaries of all stored jobs
+func (s *BoltStore) Summaries() []*models.Job {
+	return s.list(summariesBucket)
+}
+
+// GetSummaries returns summaries of the stored jobs among ids
+func (s *BoltStore) GetSummaries(ids []string) []*models.Job {
+	jobs := make([]*models.Job, 0, len(ids))
+	s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(summariesBucket)
+		for _, id := range ids {
+			data := bucket.Get([]byte(id))
+			if data == nil {
+				continue
+			}
+			if job := decodeJob(data); job != nil {
+				jobs = append(jobs, job)
+			}
+		}
+		return nil
+	})
+
+	return jobs
+}
+
+// list decodes all jobs in a bucket
+func (s *BoltStore) list(bucket []byte) []*models.Job {
+	var jobs []*models.Job
+	s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(_, data []byte) error {
+			if job := decodeJob(data); job != nil {
+				jobs = append(jobs, job)
+			}
+			return nil
+		})
+	})
+
+	return jobs
+}
+
+// Delete removes a job and its summary from the database
+func (s *BoltStore) Delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(jobsBucket).Delete([]byte(id)); err != nil {
+			return err
+		}
+		return tx.Bucket(summariesBucket).Delete([]byte(id))
+	})
+}
+
+// SaveBatch writes the batch to the database
+func (s *BoltStore) SaveBatch(batch *models.Batch) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to encode batch %s: %v", batch.ID, err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(batchesBucket).Put([]byte(batch.ID), data)
+	})
+}
+
+// GetBatch returns a batch by ID
+func (s *BoltStore) GetBatch(id string) (*models.Batch, bool) {
+	var batch *models.Batch
+	s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(batchesBucket).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		var decoded models.Batch
+		if err := json.Unmarshal(data, &decoded); err == nil {
+			batch = &decoded
+		}
+		return nil
+	})
+
+	return batch, batch != nil
+}
+
+// DeleteBatch removes a batch from the database
+func (s *BoltStore) DeleteBatch(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(batchesBucket).Delete([]byte(id))
+	})
+}
+
+// DB returns the underlying database so other components can keep their data in the same file
+func (s *BoltStore) DB() *bolt.DB {
+	return s.db
+}
+
+// Close closes the underlying database
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// decodeJob decodes a JSON-encoded job, returning nil for corrupt records
+func decodeJob(data []byte) *models.Job {
+	var job models.Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil
+	}
+	return &job
+}
@@ -0,0 +1,317 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// maxUpdateAttempts is the number of times an update is retried when another
+// replica changes the same job concurrently
+const maxUpdateAttempts = 50
+
+// listChunk is the number of jobs fetched per round trip when listing jobs
+const listChunk = 500
+
+// RedisStore keeps jobs in Redis so that several replicas of the service can
+// share them. Each job is a JSON string under its own key; a set indexes the job
+// IDs and a hash keeps a summary of each job.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore connects to the Redis server at url (e.g. "redis://localhost:6379/0")
+// and stores all keys under prefix
+func NewRedisStore(url, prefix string) (*RedisStore, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %v", err)
+	}
+	client := redis.NewClient(options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis at %s: %v", options.Addr, err)
+	}
+
+	return &RedisStore{client: client, prefix: prefix}, nil
+}
+
+// Save writes the job and its summary and adds it to the index
+func (s *RedisStore) Save(job *models.Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job %s: %v", job.ID, err)
+	}
+	summary, err := json.Marshal(job.Summary())
+	if err != nil {
+		return fmt.Errorf("failed to encode job %s: %v", job.ID, err)
+	}
+
+	ctx := context.Background()
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.jobKey(job.ID), data, 0)
+		pipe.HSet(ctx, s.key("job_summaries"), job.ID, summary)
+		pipe.SAdd(ctx, s.key("jobs"), job.ID)
+		return nil
+	})
+	return err
+}
+
+// Get returns a job by ID
+func (s *RedisStore) Get(id string) (*models.Job, bool) {
+	data, err := s.client.Get(context.Background(), s.jobKey(id)).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	job := decodeJob(data)
+	return job, job != nil
+}
+
+// List returns all stored jobs
+func (s *RedisStore) List() []*models.Job {
+	ctx := context.Background()
+	ids, err := s.client.SMembers(ctx, s.key("jobs")).Result()
+	if err != nil {
+		return nil
+	}
+
+	jobs := make([]*models.Job, 0, len(ids))
+	for start := 0; start < len(ids); start += listChunk {
+		end := start + listChunk
+		if end > len(ids) {
+			end = len(ids)
+		}
+		keys := make([]string, 0, end-start)
+		for _, id := range ids[start:end] {
+			keys = append(keys, s.jobKey(id))
+		}
+
+		values, err := s.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			continue
+		}
+		for _, value := range values {
+			// Jobs deleted since the index was read are nil
+			data, ok := value.(string)
+			if !ok {
+				continue
+			}
+			if job := decodeJob([]byte(data)); job != nil {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+
+	return jobs
+}
+
+// Summaries returns summaries of all stored jobs. Jobs written before
+// summaries were kept are summarized on the way.
+func (s *RedisStore) Summaries() []*models.Job {
+	ctx := context.Background()
+	ids, err := s.client.SMembers(ctx, s.key("jobs")).Result()
+	if err != nil {
+		return nil
+	}
+	summaries, err := s.client.HGetAll(ctx, s.key("job_summaries")).Result()
+	if err != nil {
+		return nil
+	}
+
+	jobs := make([]*models.Job, 0, len(ids))
+	var missing []string
+	for _, id := range ids {
+		data, ok := summaries[id]
+		if !ok {
+			missing = append(missing, id)
+			continue
+		}
+		if job := decodeJob([]byte(data)); job != nil {
+			jobs = append(jobs, job)
+		}
+	}
+
+	for _, id := range missing {
+		if summary := s.summarize(id); summary != nil {
+			jobs = append(jobs, summary)
+		}
+	}
+
+	return jobs
+}
+
+// GetSummaries returns summaries of the stored jobs among ids
+func (s *RedisStore) GetSummaries(ids []string) []*models.Job {
+	ctx := context.Background()
+	jobs := make([]*models.Job, 0, len(ids))
+	for start := 0; start < len(ids); start += listChunk {
+		end := start + listChunk
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		values, err := s.client.HMGet(ctx, s.key("job_summaries"), ids[start:end]...).Result()
+		if err != nil {
+			continue
+		}
+		for i, value := range values {
+			// Jobs that are not stored, or were written before summaries were kept, are nil
+			data, ok := value.(string)
+			if !ok {
+				if summary := s.summarize(ids[start+i]); summary != nil {
+					jobs = append(jobs, summary)
+				}
+				continue
+			}
+			if job := decodeJob([]byte(data)); job != nil {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+
+	return jobs
+}
+
+// summarize stores the missing summary of a job written before summaries were
+// kept and returns it, or nil if the job is not stored
+func (s *RedisStore) summarize(id string) *models.Job {
+	job, ok := s.Get(id)
+	if !ok {
+		return nil
+	}
+	summary := job.Summary()
+	if data, err := json.Marshal(summary); err == nil {
+		s.client.HSetNX(context.Background(), s.key("job_summaries"), id, data)
+	}
+	return summary
+}
+
+// Delete removes a job, its summary and its index entry
+func (s *RedisStore) Delete(id string) error {
+	ctx := context.Background()
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, s.jobKey(id))
+		pipe.HDel(ctx, s.key("job_summaries"), id)
+		pipe.SRem(ctx, s.key("jobs"), id)
+		return nil
+	})
+	return err
+}
+
+// Update applies fn to the stored job in an optimistic transaction, retrying
+// if another replica changes the job before the result is written
+func (s *RedisStore) Update(id string, fn func(job *models.Job) error) (*models.Job, error) {
+	ctx := context.Background()
+	key := s.jobKey(id)
+
+	var job *models.Job
+	update := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return ErrJobNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if job = decodeJob(data); job == nil {
+			return fmt.Errorf("failed to decode job %s", id)
+		}
+
+		if err := fn(job); err != nil {
+			return err
+		}
+
+		data, err = json.Marshal(job)
+		if err != nil {
+			return fmt.Errorf("failed to encode job %s: %v", id, err)
+		}
+		summary, err := json.Marshal(job.Summary())
+		if err != nil {
+			return fmt.Errorf("failed to encode job %s: %v", id, err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 0)
+			pipe.HSet(ctx, s.key("job_summaries"), id, summary)
+			return nil
+		})
+		return err
+	}
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		err := s.client.Watch(ctx, update, key)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return job, nil
+	}
+	return nil, fmt.Errorf("failed to update job %s: too many concurrent updates", id)
+}
+
+// SaveBatch writes the batch
+func (s *RedisStore) SaveBatch(batch *models.Batch) error {
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to encode batch %s: %v", batch.ID, err)
+	}
+
+	return s.client.Set(context.Background(), s.key("batch", batch.ID), data, 0).Err()
+}
+
+// GetBatch returns a batch by ID
+func (s *RedisStore) GetBatch(id string) (*models.Batch, bool) {
+	data, err := s.client.Get(context.Background(), s.key("batch", id)).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	var batch models.Batch
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return nil, false
+	}
+	return &batch, true
+}
+
+// DeleteBatch removes a batch
+func (s *RedisStore) DeleteBatch(id string) error {
+	return s.client.Del(context.Background(), s.key("batch", id)).Err()
+}
+
+// Client returns the underlying client so other components can keep their data in the same Redis
+func (s *RedisStore) Client() *redis.Client {
+	return s.client
+}
+
+// Prefix returns the prefix of all keys written by the store
+func (s *RedisStore) Prefix() string {
+	return s.prefix
+}
+
+// Close closes the connection to Redis
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+// jobKey returns the key of a job
+func (s *RedisStore) jobKey(id string) string {
+	return s.key("job", id)
+}
+
+// key joins parts into a key under the store prefix
+func (s *RedisStore) key(parts ...string) string {
+	key := s.prefix
+	for _, part := range parts {
+		key += ":" + part
+	}
+	return key
+}
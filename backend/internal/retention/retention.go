@@ -0,0 +1,170 @@
+package retention
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/user/subfinder-service/backend/internal/queue"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// Policy describes which finished jobs are kept. Zero values disable a limit.
+// Queued and running jobs are never purged.
+type Policy struct {
+	// Finished jobs older than this are purged
+	MaxAge time.Duration
+
+	// Oldest finished jobs are purged while more jobs than this are stored
+	MaxJobs int
+
+	// Only this many of the most recent finished jobs are kept per domain and tenant
+	KeepPerDomain int
+}
+
+// Enabled reports whether the policy limits anything
+func (p Policy) Enabled() bool {
+	return p.MaxAge > 0 || p.MaxJobs > 0 || p.KeepPerDomain > 0
+}
+
+// DefaultInterval is the time between purges if no positive interval is given
+const DefaultInterval = 10 * time.Minute
+
+// Janitor periodically purges jobs that fall outside the retention policy
+type Janitor struct {
+	queue    *queue.JobQueue
+	policy   Policy
+	interval time.Duration
+	logger   *slog.Logger
+	done     chan struct{}
+}
+
+// NewJanitor creates a janitor that applies policy every interval
+func NewJanitor(queue *queue.JobQueue, policy Policy, interval time.Duration, logger *slog.Logger) *Janitor {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Janitor{
+		queue:    queue,
+		policy:   policy,
+		interval: interval,
+		logger:   logger,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start purges once right away and then every interval until ctx is done
+func (j *Janitor) Start(ctx context.Context) {
+	j.logger.Info("Starting retention janitor", "interval", j.interval, "max_age", j.policy.MaxAge,
+		"max_jobs", j.policy.MaxJobs, "keep_per_domain", j.policy.KeepPerDomain)
+
+	go func() {
+		defer close(j.done)
+
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+
+		for {
+			j.Purge(time.Now())
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Wait waits for the janitor to stop after its context is done
+func (j *Janitor) Wait() {
+	<-j.done
+}
+
+// Purge deletes the jobs that fall outside the policy at time now and returns
+// how many were deleted. Batches are deleted together with their last job.
+func (j *Janitor) Purge(now time.Time) int {
+	jobs := j.queue.Summaries()
+	purged := 0
+	for _, id := range Expired(jobs, j.policy, now) {
+		if err := j.queue.Delete(id); err != nil {
+			// The job may have been deleted through the API in the meantime
+			if err != queue.ErrJobNotFound {
+				j.logger.Error("Failed to purge job", "job_id", id, "error", err)
+			}
+			continue
+		}
+		purged++
+	}
+
+	if purged > 0 {
+		j.logger.Info("Purged jobs outside the retention policy", "purged", purged)
+	}
+	return purged
+}
+
+// Expired returns the IDs of the finished jobs that fall outside the policy at time now
+func Expired(jobs []*models.Job, policy Policy, now time.Time) []string {
+	// Newest first, so the jobs to keep come first
+	finished := make([]*models.Job, 0, len(jobs))
+	for _, job := range jobs {
+		if job.Status.IsFinal() {
+			finished = append(finished, job)
+		}
+	}
+	sort.Slice(finished, func(a, b int) bool {
+		return finishedAt(finished[a]).After(finishedAt(finished[b]))
+	})
+
+	expired := make(map[string]bool)
+
+	if policy.MaxAge > 0 {
+		cutoff := now.Add(-policy.MaxAge)
+		for _, job := range finished {
+			if finishedAt(job).Before(cutoff) {
+				expired[job.ID] = true
+			}
+		}
+	}
+
+	if policy.KeepPerDomain > 0 {
+		kept := make(map[string]int)
+		for _, job := range finished {
+			key := job.Tenant + "/" + strings.ToLower(job.Domain)
+			if kept[key] >= policy.KeepPerDomain {
+				expired[job.ID] = true
+				continue
+			}
+			kept[key]++
+		}
+	}
+
+	if policy.MaxJobs > 0 {
+		// Count the jobs that remain after the other limits and drop the oldest finished ones
+		remaining := len(jobs) - len(expired)
+		for i := len(finished) - 1; i >= 0 && remaining > policy.MaxJobs; i-- {
+			if !expired[finished[i].ID] {
+				expired[finished[i].ID] = true
+				remaining--
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(expired))
+	for _, job := range finished {
+		if expired[job.ID] {
+			ids = append(ids, job.ID)
+		}
+	}
+	return ids
+}
+
+// finishedAt returns when a job finished, falling back to its creation time
+func finishedAt(job *models.Job) time.Time {
+	if job.CompletedAt != nil {
+		return *job.CompletedAt
+	}
+	return job.CreatedAt
+}
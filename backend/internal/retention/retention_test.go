@@ -0,0 +1,160 @@
+package retention
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// now is the time the policies are applied at in the tests
+var now = time.Date(2025, 4, 4, 12, 0, 0, 0, time.UTC)
+
+// finishedJob returns a completed job for domain that finished hoursAgo before now
+func finishedJob(id, tenant, domain string, hoursAgo int) *models.Job {
+	at := now.Add(-time.Duration(hoursAgo) * time.Hour)
+	return &models.Job{
+		ID:          id,
+		Tenant:      tenant,
+		Domain:      domain,
+		Status:      models.JobStatusCompleted,
+		CreatedAt:   at.Add(-time.Minute),
+		CompletedAt: &at,
+	}
+}
+
+// activeJob returns a job with the given status that has not finished
+func activeJob(id string, status models.JobStatus, hoursAgo int) *models.Job {
+	return &models.Job{
+		ID:        id,
+		Domain:    "example.com",
+		Status:    status,
+		CreatedAt: now.Add(-time.Duration(hoursAgo) * time.Hour),
+	}
+}
+
+func TestExpired(t *testing.T) {
+	failed := finishedJob("failed", "", "example.com", 30)
+	failed.Status = models.JobStatusFailed
+	canceledEarly := finishedJob("canceled", "", "example.com", 40)
+	canceledEarly.Status = models.JobStatusCanceled
+	canceledEarly.CompletedAt = nil
+
+	tests := []struct {
+		name   string
+		jobs   []*models.Job
+		policy Policy
+		want   []string
+	}{
+		{
+			name:   "no limits",
+			jobs:   []*models.Job{finishedJob("old", "", "example.com", 1000)},
+			policy: Policy{},
+			want:   []string{},
+		},
+		{
+			name: "max age",
+			jobs: []*models.Job{
+				finishedJob("new", "", "example.com", 1),
+				finishedJob("old", "", "example.com", 48),
+				failed,
+			},
+			policy: Policy{MaxAge: 24 * time.Hour},
+			want:   []string{"failed", "old"},
+		},
+		{
+			name: "max age of a job without completion time uses its creation time",
+			jobs: []*models.Job{
+				finishedJob("new", "", "example.com", 1),
+				canceledEarly,
+			},
+			policy: Policy{MaxAge: 24 * time.Hour},
+			want:   []string{"canceled"},
+		},
+		{
+			name: "queued and running jobs are never purged",
+			jobs: []*models.Job{
+				activeJob("queued", models.JobStatusQueued, 100),
+				activeJob("running", models.JobStatusRunning, 100),
+			},
+			policy: Policy{MaxAge: time.Hour, MaxJobs: 1, KeepPerDomain: 1},
+			want:   []string{},
+		},
+		{
+			name: "keep per domain counts domains case-insensitively",
+			jobs: []*models.Job{
+				finishedJob("a1", "", "example.com", 1),
+				finishedJob("a2", "", "EXAMPLE.com", 2),
+				finishedJob("a3", "", "example.com", 3),
+				finishedJob("b1", "", "example.org", 4),
+			},
+			policy: Policy{KeepPerDomain: 2},
+			want:   []string{"a3"},
+		},
+		{
+			name: "keep per domain counts each tenant apart",
+			jobs: []*models.Job{
+				finishedJob("acme1", "acme", "example.com", 1),
+				finishedJob("globex1", "globex", "example.com", 2),
+				finishedJob("acme2", "acme", "example.com", 3),
+			},
+			policy: Policy{KeepPerDomain: 1},
+			want:   []string{"acme2"},
+		},
+		{
+			name: "max jobs purges the oldest finished jobs",
+			jobs: []*models.Job{
+				finishedJob("j1", "", "a.example.com", 1),
+				finishedJob("j2", "", "b.example.com", 2),
+				finishedJob("j3", "", "c.example.com", 3),
+				finishedJob("j4", "", "d.example.com", 4),
+			},
+			policy: Policy{MaxJobs: 2},
+			want:   []string{"j3", "j4"},
+		},
+		{
+			name: "max jobs counts what the other limits leave",
+			jobs: []*models.Job{
+				finishedJob("j1", "", "example.com", 1),
+				finishedJob("j2", "", "example.com", 2),
+				finishedJob("j3", "", "example.org", 3),
+				finishedJob("j4", "", "example.org", 100),
+			},
+			policy: Policy{MaxAge: 24 * time.Hour, KeepPerDomain: 1, MaxJobs: 2},
+			want:   []string{"j2", "j4"},
+		},
+		{
+			name: "max jobs counts queued and running jobs that cannot be purged",
+			jobs: []*models.Job{
+				activeJob("queued", models.JobStatusQueued, 1),
+				activeJob("running", models.JobStatusRunning, 1),
+				activeJob("running2", models.JobStatusRunning, 2),
+				finishedJob("j1", "", "a.example.com", 1),
+				finishedJob("j2", "", "b.example.com", 2),
+			},
+			policy: Policy{MaxJobs: 3},
+			want:   []string{"j1", "j2"},
+		},
+		{
+			name: "max jobs stops once enough jobs are left",
+			jobs: []*models.Job{
+				activeJob("queued", models.JobStatusQueued, 1),
+				finishedJob("j1", "", "a.example.com", 1),
+				finishedJob("j2", "", "b.example.com", 2),
+				finishedJob("j3", "", "c.example.com", 3),
+			},
+			policy: Policy{MaxJobs: 3},
+			want:   []string{"j3"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Expired(test.jobs, test.policy, now)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,369 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+	"github.com/user/subfinder-service/backend/internal/auth"
+	"github.com/user/subfinder-service/backend/internal/queue"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// Errors
+var (
+	ErrScheduleNotFound = errors.New("schedule not found")
+	ErrInvalidSchedule  = errors.New("invalid schedule")
+)
+
+// syncInterval is how often schedules changed by other replicas are picked
+// up when the store is shared
+const syncInterval = 30 * time.Second
+
+// Scheduler creates jobs for stored schedules when their cron expressions fire
+type Scheduler struct {
+	store   Store
+	queue   *queue.JobQueue
+	keys    *auth.Manager
+	logger  *slog.Logger
+	cron    *cron.Cron
+	entries map[string]cron.EntryID
+	mutex   sync.Mutex
+
+	// Options applied to schedules that do not set them
+	defaults models.SubfinderConfig
+
+	// Last update of each registered schedule, to detect changes by other replicas
+	versions map[string]time.Time
+
+	// Closed to stop syncing with other replicas
+	done chan struct{}
+}
+
+// New creates a new scheduler that enqueues jobs on the given queue. Jobs of
+// schedules created with an API key count against its quota unless keys is
+// nil. Options that a schedule does not set are taken from defaults.
+func New(store Store, queue *queue.JobQueue, keys *auth.Manager, defaults models.SubfinderConfig, logger *slog.Logger) *Scheduler {
+	return &Scheduler{
+		store:    store,
+		queue:    queue,
+		keys:     keys,
+		defaults: defaults,
+		logger:   logger,
+		cron:     cron.New(),
+		entries:  make(map[string]cron.EntryID),
+		versions: make(map[string]time.Time),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start registers all enabled schedules and starts firing them
+func (s *Scheduler) Start() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, schedule := range s.store.List() {
+		if !schedule.Enabled {
+			continue
+		}
+		if err := s.register(schedule); err != nil {
+			return fmt.Errorf("failed to register schedule %s: %v", schedule.ID, err)
+		}
+	}
+
+	s.logger.Info("Starting scheduler", "enabled_schedules", len(s.entries))
+	s.cron.Start()
+
+	// Pick up schedules created, changed or deleted by other replicas
+	if _, ok := s.store.(Claimer); ok {
+		go func() {
+			ticker := time.NewTicker(syncInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-s.done:
+					return
+				case <-ticker.C:
+					s.sync()
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// Stop stops firing schedules and waits for running triggers to finish
+func (s *Scheduler) Stop() {
+	close(s.done)
+	<-s.cron.Stop().Done()
+}
+
+// sync registers the stored schedules that are not registered in their
+// current version and unregisters the schedules that were deleted or disabled
+func (s *Scheduler) sync() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored := make(map[string]bool)
+	for _, schedule := range s.store.List() {
+		if !schedule.Enabled {
+			continue
+		}
+		stored[schedule.ID] = true
+		if version, ok := s.versions[schedule.ID]; ok && version.Equal(schedule.UpdatedAt) {
+			continue
+		}
+		s.unregister(schedule.ID)
+		if err := s.register(schedule); err != nil {
+			s.logger.Error("Failed to register schedule", "schedule_id", schedule.ID, "error", err)
+		}
+	}
+
+	for id := range s.entries {
+		if !stored[id] {
+			s.unregister(id)
+		}
+	}
+}
+
+// Create validates and stores a new schedule owned by tenant. Its jobs count
+// against the quota of the API key with ID keyID, if not empty.
+func (s *Scheduler) Create(request models.ScheduleRequest, tenant, keyID string) (*models.Schedule, error) {
+	now := time.Now()
+	schedule := &models.Schedule{
+		ID:        uuid.New().String(),
+		CreatedAt: now,
+		Tenant:    tenant,
+		APIKeyID:  keyID,
+	}
+	if err := s.applyRequest(schedule, request); err != nil {
+		return nil, err
+	}
+	schedule.UpdatedAt = now
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.store.Save(schedule); err != nil {
+		return nil, err
+	}
+	if schedule.Enabled {
+		if err := s.register(schedule); err != nil {
+			return nil, err
+		}
+	}
+
+	s.logger.Info("Created schedule", "schedule_id", schedule.ID, "domain", schedule.Domain, "cron", schedule.Cron)
+	return s.withNextRun(schedule), nil
+}
+
+// Update replaces the domain, configuration, cron expression and enabled flag of a schedule
+func (s *Scheduler) Update(id string, request models.ScheduleRequest) (*models.Schedule, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Runs recorded in the meantime are kept
+	schedule, err := s.store.Update(id, func(schedule *models.Schedule) error {
+		if err := s.applyRequest(schedule, request); err != nil {
+			return err
+		}
+		schedule.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.unregister(id)
+	if schedule.Enabled {
+		if err := s.register(schedule); err != nil {
+			return nil, err
+		}
+	}
+
+	s.logger.Info("Updated schedule", "schedule_id", id)
+	return s.withNextRun(schedule), nil
+}
+
+// Delete removes a schedule. Jobs it already created are kept.
+func (s *Scheduler) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.store.Get(id); !ok {
+		return ErrScheduleNotFound
+	}
+	if err := s.store.Delete(id); err != nil {
+		return err
+	}
+	s.unregister(id)
+
+	s.logger.Info("Deleted schedule", "schedule_id", id)
+	return nil
+}
+
+// Get returns a schedule by ID
+func (s *Scheduler) Get(id string) (*models.Schedule, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	schedule, ok := s.store.Get(id)
+	if !ok {
+		return nil, false
+	}
+	return s.withNextRun(schedule), true
+}
+
+// List returns all schedules sorted by creation time
+func (s *Scheduler) List() []*models.Schedule {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	schedules := s.store.List()
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].CreatedAt.Before(schedules[j].CreatedAt)
+	})
+	for i, schedule := range schedules {
+		schedules[i] = s.withNextRun(schedule)
+	}
+	return schedules
+}
+
+// register adds a schedule to the cron runner. The caller must hold the mutex.
+func (s *Scheduler) register(schedule *models.Schedule) error {
+	id := schedule.ID
+	entryID, err := s.cron.AddFunc(schedule.Cron, func() {
+		s.fire(id)
+	})
+	if err != nil {
+		return fmt.Errorf("invalid cron expression %q: %v", schedule.Cron, err)
+	}
+	s.entries[id] = entryID
+	s.versions[id] = schedule.UpdatedAt
+	return nil
+}
+
+// unregister removes a schedule from the cron runner. The caller must hold the mutex.
+func (s *Scheduler) unregister(id string) {
+	if entryID, ok := s.entries[id]; ok {
+		s.cron.Remove(entryID)
+		delete(s.entries, id)
+		delete(s.versions, id)
+	}
+}
+
+// withNextRun fills in the next time the schedule fires. The caller must hold the mutex.
+func (s *Scheduler) withNextRun(schedule *models.Schedule) *models.Schedule {
+	schedule.NextRunAt = nil
+	if entryID, ok := s.entries[schedule.ID]; ok {
+		if next := s.cron.Entry(entryID).Next; !next.IsZero() {
+			schedule.NextRunAt = &next
+		}
+	}
+	return schedule
+}
+
+// fire enqueues a job for a schedule and records the outcome on the schedule.
+// The mutex is not held while the job is enqueued, which may wait for the
+// quota of the schedule's API key.
+func (s *Scheduler) fire(id string) {
+	s.mutex.Lock()
+	version, registered := s.versions[id]
+	s.mutex.Unlock()
+	if !registered {
+		return
+	}
+
+	schedule, ok := s.store.Get(id)
+	if !ok || !schedule.Enabled {
+		return
+	}
+
+	// Skip runs of an outdated version changed by another replica and runs
+	// another replica already created a job for
+	if !schedule.UpdatedAt.Equal(version) {
+		return
+	}
+	now := time.Now()
+	if claimer, ok := s.store.(Claimer); ok && !claimer.Claim(id, now.Truncate(time.Minute)) {
+		return
+	}
+
+	job := &models.Job{
+		ID:         uuid.New().String(),
+		Domain:     schedule.Domain,
+		Config:     schedule.Config,
+		Status:     models.JobStatusQueued,
+		CreatedAt:  now,
+		ScheduleID: schedule.ID,
+		APIKeyID:   schedule.APIKeyID,
+		Tenant:     schedule.Tenant,
+		Priority:   models.JobPriorityNormal,
+	}
+
+	lastError := ""
+	if err := s.enqueue(job, now); err != nil {
+		s.logger.Error("Schedule failed to enqueue job", "schedule_id", id, "domain", schedule.Domain, "error", err)
+		lastError = err.Error()
+	} else {
+		s.logger.Info("Schedule enqueued job", "schedule_id", id, "job_id", job.ID, "domain", schedule.Domain)
+	}
+
+	// Record only the run, keeping changes made to the schedule in the meantime
+	_, err := s.store.Update(id, func(schedule *models.Schedule) error {
+		schedule.LastRunAt = &now
+		schedule.LastError = lastError
+		if lastError == "" {
+			schedule.LastJobID = job.ID
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrScheduleNotFound) {
+		s.logger.Error("Failed to update schedule", "schedule_id", id, "error", err)
+	}
+}
+
+// enqueue adds a scheduled job to the queue, counting it against the quota
+// of the API key that created its schedule
+func (s *Scheduler) enqueue(job *models.Job, now time.Time) error {
+	if s.keys == nil || job.APIKeyID == "" {
+		return s.queue.Enqueue(job)
+	}
+
+	key, err := s.keys.Key(job.APIKeyID)
+	if err != nil {
+		return fmt.Errorf("API key of the schedule: %w", err)
+	}
+	release, err := s.keys.Reserve(key, 1, s.queue.ActiveJobs, now)
+	if err != nil {
+		return err
+	}
+	err = s.queue.Enqueue(job)
+	release(err == nil)
+	return err
+}
+
+// applyRequest validates a request and copies it onto a schedule
+func (s *Scheduler) applyRequest(schedule *models.Schedule, request models.ScheduleRequest) error {
+	domain := strings.TrimSpace(request.Domain)
+	if domain == "" {
+		return fmt.Errorf("%w: domain is required", ErrInvalidSchedule)
+	}
+	expression := strings.TrimSpace(request.Cron)
+	if _, err := cron.ParseStandard(expression); err != nil {
+		return fmt.Errorf("%w: invalid cron expression %q: %v", ErrInvalidSchedule, request.Cron, err)
+	}
+
+	request.Config.ApplyDefaults(s.defaults)
+
+	schedule.Domain = domain
+	schedule.Config = request.Config
+	schedule.Cron = expression
+	schedule.Enabled = request.Enabled == nil || *request.Enabled
+	return nil
+}
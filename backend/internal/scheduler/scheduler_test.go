@@ -0,0 +1,247 @@
+package scheduler
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/user/subfinder-service/backend/internal/queue"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// newTestScheduler returns a scheduler on store whose jobs go to a new in-memory queue
+func newTestScheduler(store Store) (*Scheduler, *queue.JobQueue) {
+	q := queue.NewJobQueue(queue.NewMemoryStore(), queue.DefaultCapacity)
+	return New(store, q, nil, models.SubfinderConfig{}, slog.New(slog.NewTextHandler(io.Discard, nil))), q
+}
+
+// racingStore runs change after every Get, like another replica or an API
+// call updating the schedule while it fires
+type racingStore struct {
+	Store
+	change func(id string)
+}
+
+// Get implements Store
+func (s *racingStore) Get(id string) (*models.Schedule, bool) {
+	schedule, ok := s.Store.Get(id)
+	if ok {
+		s.change(id)
+	}
+	return schedule, ok
+}
+
+func TestCreateValidatesRequests(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		name        string
+		request     models.ScheduleRequest
+		wantErr     bool
+		wantCron    string
+		wantEnabled bool
+	}{
+		{
+			name:        "standard expression",
+			request:     models.ScheduleRequest{Domain: "example.com", Cron: "0 2 * * *"},
+			wantCron:    "0 2 * * *",
+			wantEnabled: true,
+		},
+		{
+			name:        "descriptor with surrounding spaces",
+			request:     models.ScheduleRequest{Domain: " example.com ", Cron: " @daily "},
+			wantCron:    "@daily",
+			wantEnabled: true,
+		},
+		{
+			name:     "disabled",
+			request:  models.ScheduleRequest{Domain: "example.com", Cron: "@hourly", Enabled: &disabled},
+			wantCron: "@hourly",
+		},
+		{
+			name:    "minute out of range",
+			request: models.ScheduleRequest{Domain: "example.com", Cron: "61 * * * *"},
+			wantErr: true,
+		},
+		{
+			name:    "seconds field",
+			request: models.ScheduleRequest{Domain: "example.com", Cron: "0 0 2 * * *"},
+			wantErr: true,
+		},
+		{
+			name:    "not an expression",
+			request: models.ScheduleRequest{Domain: "example.com", Cron: "every day"},
+			wantErr: true,
+		},
+		{
+			name:    "missing domain",
+			request: models.ScheduleRequest{Domain: " ", Cron: "@daily"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, _ := newTestScheduler(NewMemoryStore())
+			if err := s.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer s.Stop()
+
+			schedule, err := s.Create(test.request, "", "")
+			if test.wantErr {
+				if !errors.Is(err, ErrInvalidSchedule) {
+					t.Errorf("got %v, want ErrInvalidSchedule", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if schedule.Domain != "example.com" || schedule.Cron != test.wantCron || schedule.Enabled != test.wantEnabled {
+				t.Errorf("got domain %q, cron %q, enabled %v", schedule.Domain, schedule.Cron, schedule.Enabled)
+			}
+			if (schedule.NextRunAt != nil) != test.wantEnabled {
+				t.Errorf("next run %v for enabled %v", schedule.NextRunAt, schedule.Enabled)
+			}
+		})
+	}
+}
+
+func TestFireSkipsOutdatedVersions(t *testing.T) {
+	store := NewMemoryStore()
+	s, q := newTestScheduler(store)
+	schedule, err := s.Create(models.ScheduleRequest{Domain: "example.com", Cron: "@daily"}, "acme", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another replica changed the schedule; runs wait until it is registered again
+	_, err = store.Update(schedule.ID, func(schedule *models.Schedule) error {
+		schedule.Domain = "example.org"
+		schedule.UpdatedAt = schedule.UpdatedAt.Add(time.Second)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.fire(schedule.ID)
+	if n := len(q.List()); n != 0 {
+		t.Fatalf("outdated version created %d jobs", n)
+	}
+
+	s.sync()
+	s.fire(schedule.ID)
+	jobs := q.List()
+	if len(jobs) != 1 || jobs[0].Domain != "example.org" || jobs[0].Tenant != "acme" || jobs[0].ScheduleID != schedule.ID {
+		t.Fatalf("got jobs %+v, want one for example.org", jobs)
+	}
+	stored, _ := store.Get(schedule.ID)
+	if stored.LastJobID != jobs[0].ID || stored.LastRunAt == nil || stored.LastError != "" {
+		t.Errorf("run not recorded: %+v", stored)
+	}
+}
+
+func TestFireKeepsConcurrentChanges(t *testing.T) {
+	memory := NewMemoryStore()
+	store := &racingStore{Store: memory}
+	s, q := newTestScheduler(store)
+	schedule, err := s.Create(models.ScheduleRequest{Domain: "example.com", Cron: "@daily"}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The schedule is disabled while the job is being enqueued
+	store.change = func(id string) {
+		memory.Update(id, func(schedule *models.Schedule) error {
+			schedule.Enabled = false
+			return nil
+		})
+	}
+	s.fire(schedule.ID)
+
+	stored, _ := memory.Get(schedule.ID)
+	if stored.Enabled {
+		t.Error("recording the run enabled the schedule again")
+	}
+	if jobs := q.List(); len(jobs) != 1 || stored.LastJobID != jobs[0].ID {
+		t.Errorf("run not recorded: last job %q", stored.LastJobID)
+	}
+}
+
+func TestFireOfDeletedSchedule(t *testing.T) {
+	s, q := newTestScheduler(NewMemoryStore())
+	schedule, err := s.Create(models.ScheduleRequest{Domain: "example.com", Cron: "@daily"}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(schedule.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	s.fire(schedule.ID)
+	if n := len(q.List()); n != 0 {
+		t.Errorf("deleted schedule created %d jobs", n)
+	}
+	if _, err := s.Update(schedule.ID, models.ScheduleRequest{Domain: "example.com", Cron: "@daily"}); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("update: got %v, want ErrScheduleNotFound", err)
+	}
+}
+
+func TestRedisClaimCreatesOneJobPerRun(t *testing.T) {
+	server := miniredis.RunT(t)
+	var replicas []*RedisStore
+	for i := 0; i < 2; i++ {
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { client.Close() })
+		replicas = append(replicas, NewRedisStore(client, "test"))
+	}
+
+	at := time.Date(2025, 4, 4, 2, 0, 0, 0, time.UTC)
+	if !replicas[0].Claim("schedule", at) {
+		t.Fatal("first claim of a run failed")
+	}
+	if replicas[1].Claim("schedule", at) {
+		t.Error("run claimed by two replicas")
+	}
+	if !replicas[1].Claim("schedule", at.Add(time.Minute)) {
+		t.Error("claim of the next run failed")
+	}
+	if !replicas[1].Claim("other", at) {
+		t.Error("claim of another schedule's run failed")
+	}
+
+	// Claims are forgotten once no replica can still fire the run
+	server.FastForward(claimTTL + time.Second)
+	if !replicas[0].Claim("schedule", at) {
+		t.Error("claim not released after its TTL")
+	}
+}
+
+func TestRedisStoreUpdate(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	store := NewRedisStore(client, "test")
+
+	if err := store.Save(&models.Schedule{ID: "schedule", Domain: "example.com", Cron: "@daily"}); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := store.Update("schedule", func(schedule *models.Schedule) error {
+		schedule.LastJobID = "job"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := store.Get("schedule")
+	if updated.LastJobID != "job" || stored.LastJobID != "job" || stored.Cron != "@daily" {
+		t.Errorf("got %+v, stored %+v", updated, stored)
+	}
+	if _, err := store.Update("missing", func(*models.Schedule) error { return nil }); !errors.Is(err, ErrScheduleNotFound) {
+		t.Errorf("update of a missing schedule: got %v, want ErrScheduleNotFound", err)
+	}
+}
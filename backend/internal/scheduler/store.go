@@ -0,0 +1,336 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/user/subfinder-service/backend/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store persists schedules
+type Store interface {
+	// Save inserts or replaces a schedule
+	Save(schedule *models.Schedule) error
+
+	// Get returns a schedule by ID
+	Get(id string) (*models.Schedule, bool)
+
+	// Update applies fn to the stored schedule atomically and returns the
+	// result, or ErrScheduleNotFound. Stores shared between replicas may call
+	// fn more than once.
+	Update(id string, fn func(schedule *models.Schedule) error) (*models.Schedule, error)
+
+	// List returns all stored schedules
+	List() []*models.Schedule
+
+	// Delete removes a schedule
+	Delete(id string) error
+}
+
+// Claimer is implemented by stores shared between replicas of the service.
+// Claim reports whether this replica is the first to claim the run of a
+// schedule at the given time, so that each run creates only one job.
+type Claimer interface {
+	Claim(id string, at time.Time) bool
+}
+
+// MemoryStore keeps schedules in an in-memory map
+type MemoryStore struct {
+	schedules map[string]*models.Schedule
+	mutex     sync.RWMutex
+}
+
+// NewMemoryStore creates a new in-memory schedule store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		schedules: make(map[string]*models.Schedule),
+	}
+}
+
+// Save stores a copy of the schedule in the map
+func (s *MemoryStore) Save(schedule *models.Schedule) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored := *schedule
+	s.schedules[schedule.ID] = &stored
+	return nil
+}
+
+// Get returns a copy of a schedule by ID
+func (s *MemoryStore) Get(id string) (*models.Schedule, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	schedule, ok := s.schedules[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *schedule
+	return &copied, true
+}
+
+// Update applies fn to the stored schedule under the lock of the map
+func (s *MemoryStore) Update(id string, fn func(schedule *models.Schedule) error) (*models.Schedule, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored, ok := s.schedules[id]
+	if !ok {
+		return nil, ErrScheduleNotFound
+	}
+	schedule := *stored
+	if err := fn(&schedule); err != nil {
+		return nil, err
+	}
+	s.schedules[id] = &schedule
+
+	updated := schedule
+	return &updated, nil
+}
+
+// List returns copies of all stored schedules
+func (s *MemoryStore) List() []*models.Schedule {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	schedules := make([]*models.Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		copied := *schedule
+		schedules = append(schedules, &copied)
+	}
+	return schedules
+}
+
+// Delete removes a schedule from the map
+func (s *MemoryStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.schedules, id)
+	return nil
+}
+
+// schedulesBucket is the BoltDB bucket holding JSON-encoded schedules keyed by ID
+var schedulesBucket = []byte("schedules")
+
+// BoltStore keeps schedules in the BoltDB file shared with the job store
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore creates a schedule store in an open BoltDB database
+func NewBoltStore(db *bolt.DB) (*BoltStore, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(schedulesBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize schedule store: %v", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// Save writes the schedule to the database
+func (s *BoltStore) Save(schedule *models.Schedule) error {
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule %s: %v", schedule.ID, err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulesBucket).Put([]byte(schedule.ID), data)
+	})
+}
+
+// Get returns a schedule by ID
+func (s *BoltStore) Get(id string) (*models.Schedule, bool) {
+	var schedule *models.Schedule
+	s.db.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(schedulesBucket).Get([]byte(id)); data != nil {
+			schedule = decodeSchedule(data)
+		}
+		return nil
+	})
+
+	return schedule, schedule != nil
+}
+
+// Update applies fn to the stored schedule in a single transaction
+func (s *BoltStore) Update(id string, fn func(schedule *models.Schedule) error) (*models.Schedule, error) {
+	var schedule *models.Schedule
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(schedulesBucket)
+		data := bucket.Get([]byte(id))
+		if data == nil {
+			return ErrScheduleNotFound
+		}
+		if schedule = decodeSchedule(data); schedule == nil {
+			return fmt.Errorf("failed to decode schedule %s", id)
+		}
+		if err := fn(schedule); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(schedule)
+		if err != nil {
+			return fmt.Errorf("failed to encode schedule %s: %v", id, err)
+		}
+		return bucket.Put([]byte(id), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// List returns all stored schedules
+func (s *BoltStore) List() []*models.Schedule {
+	var schedules []*models.Schedule
+	s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulesBucket).ForEach(func(_, data []byte) error {
+			if schedule := decodeSchedule(data); schedule != nil {
+				schedules = append(schedules, schedule)
+			}
+			return nil
+		})
+	})
+
+	return schedules
+}
+
+// Delete removes a schedule from the database
+func (s *BoltStore) Delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulesBucket).Delete([]byte(id))
+	})
+}
+
+// decodeSchedule decodes a JSON-encoded schedule, returning nil for corrupt records
+func decodeSchedule(data []byte) *models.Schedule {
+	var schedule models.Schedule
+	if err := json.Unmarshal(data, &schedule); err != nil {
+		return nil
+	}
+	return &schedule
+}
+
+// RedisStore keeps schedules in a Redis hash shared by all replicas of the service
+type RedisStore struct {
+	client *redis.Client
+	key    string
+}
+
+// NewRedisStore creates a schedule store in the Redis database of the job store, under prefix
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, key: prefix + ":schedules"}
+}
+
+// Save writes the schedule to the hash
+func (s *RedisStore) Save(schedule *models.Schedule) error {
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule %s: %v", schedule.ID, err)
+	}
+
+	return s.client.HSet(context.Background(), s.key, schedule.ID, data).Err()
+}
+
+// Get returns a schedule by ID
+func (s *RedisStore) Get(id string) (*models.Schedule, bool) {
+	data, err := s.client.HGet(context.Background(), s.key, id).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	schedule := decodeSchedule(data)
+	return schedule, schedule != nil
+}
+
+// maxUpdateAttempts is the number of times an update is retried when another
+// replica changes the schedules concurrently
+const maxUpdateAttempts = 50
+
+// Update applies fn to the stored schedule in an optimistic transaction,
+// retrying if another replica changes the schedules before the result is written
+func (s *RedisStore) Update(id string, fn func(schedule *models.Schedule) error) (*models.Schedule, error) {
+	ctx := context.Background()
+
+	var schedule *models.Schedule
+	update := func(tx *redis.Tx) error {
+		data, err := tx.HGet(ctx, s.key, id).Bytes()
+		if errors.Is(err, redis.Nil) {
+			return ErrScheduleNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if schedule = decodeSchedule(data); schedule == nil {
+			return fmt.Errorf("failed to decode schedule %s", id)
+		}
+		if err := fn(schedule); err != nil {
+			return err
+		}
+
+		data, err = json.Marshal(schedule)
+		if err != nil {
+			return fmt.Errorf("failed to encode schedule %s: %v", id, err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, s.key, id, data)
+			return nil
+		})
+		return err
+	}
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		err := s.client.Watch(ctx, update, s.key)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return schedule, nil
+	}
+	return nil, fmt.Errorf("failed to update schedule %s: too many concurrent updates", id)
+}
+
+// List returns all stored schedules
+func (s *RedisStore) List() []*models.Schedule {
+	values, err := s.client.HGetAll(context.Background(), s.key).Result()
+	if err != nil {
+		return nil
+	}
+
+	schedules := make([]*models.Schedule, 0, len(values))
+	for _, data := range values {
+		if schedule := decodeSchedule([]byte(data)); schedule != nil {
+			schedules = append(schedules, schedule)
+		}
+	}
+	return schedules
+}
+
+// Delete removes a schedule from the hash
+func (s *RedisStore) Delete(id string) error {
+	return s.client.HDel(context.Background(), s.key, id).Err()
+}
+
+// claimTTL is how long a claimed run is remembered, well beyond the clock
+// skew between replicas
+const claimTTL = time.Hour
+
+// Claim records the run of a schedule at the given time, reporting whether
+// no replica claimed it before. Runs are not claimed while Redis is unavailable.
+func (s *RedisStore) Claim(id string, at time.Time) bool {
+	key := fmt.Sprintf("%s:run:%s:%d", s.key, id, at.Unix())
+	claimed, err := s.client.SetNX(context.Background(), key, 1, claimTTL).Result()
+	return err == nil && claimed
+}
@@ -1,35 +1,83 @@
 package subfinder
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
+	"os"
 	"os/exec"
 	"strings"
+	"time"
 
+	"github.com/user/subfinder-service/backend/internal/metrics"
+	"github.com/user/subfinder-service/backend/internal/tracing"
 	"github.com/user/subfinder-service/backend/pkg/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Client represents a client for the subfinder library
-type Client struct {
-	logger *log.Logger
+// Enumerator finds subdomains for a domain
+type Enumerator interface {
+	// FindSubdomains enumerates the subdomains of domain. If onResult is not nil
+	// it is called for every subdomain as soon as it is found. On error the
+	// returned Result may still carry the diagnostic log.
+	FindSubdomains(ctx context.Context, domain string, config models.SubfinderConfig, onResult func(models.SubdomainInfo)) (*Result, error)
 }
 
-// NewClient creates a new subfinder client
-func NewClient(logger *log.Logger) *Client {
-	return &Client{
-		logger: logger,
+// Result represents the outcome of an enumeration
+type Result struct {
+	// Subdomains found after filtering
+	Subdomains []models.SubdomainInfo
+
+	// Sources queried during the enumeration
+	SourcesUsed []string
+
+	// Per-source breakdown of results and errors
+	Sources []models.SourceStats
+
+	// Diagnostic output that is not a result, such as banners and warnings
+	Log []string
+}
+
+// CLIClient represents a client that runs the subfinder binary
+type CLIClient struct {
+	providerConfig string
+	keys           KeySource
+	logger         *slog.Logger
+}
+
+// NewCLIClient creates a new subfinder CLI client. If keys is not nil, every
+// run gets a temporary provider config holding the keys of providerConfig
+// combined with those from keys. Otherwise subfinder uses its own provider config.
+func NewCLIClient(providerConfig string, keys KeySource, logger *slog.Logger) *CLIClient {
+	return &CLIClient{
+		providerConfig: providerConfig,
+		keys:           keys,
+		logger:         logger,
 	}
 }
 
-// FindSubdomains finds subdomains for the specified domain using subfinder
-func (c *Client) FindSubdomains(ctx context.Context, domain string, config models.SubfinderConfig) ([]models.SubdomainInfo, []string, error) {
-	c.logger.Printf("Finding subdomains for domain %s", domain)
+// FindSubdomains finds subdomains for the specified domain using subfinder.
+// If onResult is not nil it is called for every subdomain as soon as subfinder
+// reports it, after the depth and www filters have been applied. IPs resolved
+// after subfinder exits are only present in the returned slice.
+func (c *CLIClient) FindSubdomains(ctx context.Context, domain string, config models.SubfinderConfig, onResult func(models.SubdomainInfo)) (*Result, error) {
+	ctx, span := startFind(ctx, "cli", domain)
+	result, err := c.find(ctx, domain, config, onResult)
+	endFind(span, result, err)
+	return result, err
+}
+
+// find runs subfinder for FindSubdomains
+func (c *CLIClient) find(ctx context.Context, domain string, config models.SubfinderConfig, onResult func(models.SubdomainInfo)) (*Result, error) {
+	c.logger.InfoContext(ctx, "Finding subdomains", "client", "cli")
 
 	// Ensure the subfinder binary exists
 	if _, err := exec.LookPath("subfinder"); err != nil {
-		return nil, nil, fmt.Errorf("subfinder binary not found: %v", err)
+		return nil, fmt.Errorf("subfinder binary not found: %v", err)
 	}
 
 	// Build the command
@@ -73,98 +121,134 @@ func (c *Client) FindSubdomains(ctx context.Context, domain string, config model
 		args = append(args, "-timeout", fmt.Sprintf("%d", config.Timeout))
 	}
 
-	// Add silent mode to get clean output
-	args = append(args, "-silent")
-
-	// Create the command
-	cmd := exec.CommandContext(ctx, "subfinder", args...)
+	// Write one JSON record per subdomain with every source that reported it.
+	// The per-source statistics table goes to stderr, which -silent would
+	// suppress; -nc keeps color codes out of it.
+	args = append(args, "-oJ", "-cs", "-stats", "-nc")
 
-	// Log the command being executed
-	c.logger.Printf("Executing command: subfinder %s", strings.Join(args, " "))
-
-	// Run the command and get the output
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		c.logger.Printf("Command failed with error: %v, output: %s", err, string(output))
-		if ctx.Err() != nil {
-			return nil, nil, fmt.Errorf("subfinder canceled: %v", ctx.Err())
+	// Pass the provider keys in a config file that only exists for this run
+	if c.keys != nil {
+		keys, err := providerKeys(c.providerConfig, c.keys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load provider keys: %v", err)
 		}
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return nil, nil, fmt.Errorf("subfinder failed: %s", string(exitErr.Stderr))
+		path, err := writeProviderConfig(keys)
+		if err != nil {
+			return nil, err
 		}
-		return nil, nil, fmt.Errorf("failed to run subfinder: %v, output: %s", err, string(output))
+		defer os.Remove(path)
+		args = append(args, "-pc", path)
 	}
 
-	// Parse the output into structured data
-	subdomainInfos := parseSubfinderOutput(string(output), includeIPsFromTool)
+	// Create the command
+	cmd := exec.CommandContext(ctx, "subfinder", args...)
 
-	// If IPs were not retrieved directly from the tool, resolve them manually
-	if config.IncludeIPs && !includeIPsFromTool {
-		c.logger.Printf("Resolving IPs for %d subdomains", len(subdomainInfos))
-		subdomainInfos = resolveIPs(ctx, subdomainInfos)
+	// Capture stderr separately so stdout only carries results
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open subfinder output: %v", err)
 	}
 
-	// Apply depth filtering if maxDepth is set
-	if config.MaxDepth > 0 {
-		c.logger.Printf("Filtering subdomains by depth: %d", config.MaxDepth)
-		subdomainInfos = filterSubdomainsByDepth(subdomainInfos, domain, config.MaxDepth)
+	// Log the command being executed
+	c.logger.DebugContext(ctx, "Executing subfinder", "args", args)
+
+	// Trace the subfinder process from start to exit
+	_, run := tracing.Tracer().Start(ctx, "subfinder exec", trace.WithAttributes(
+		attribute.StringSlice("process.command_args", append([]string{"subfinder"}, args...)),
+	))
+	if err := cmd.Start(); err != nil {
+		tracing.Fail(run, err)
+		run.End()
+		return nil, fmt.Errorf("failed to run subfinder: %v", err)
 	}
 
-	// Apply www filtering if excludeWww is set
-	if config.ExcludeWww {
-		c.logger.Printf("Filtering out www subdomains")
-		subdomainInfos = filterWwwSubdomains(subdomainInfos, true)
-	}
+	// Parse the output line by line as subfinder reports results
+	var subdomainInfos []models.SubdomainInfo
+	var output jobLog
+	sources := newSourceCollector()
+	var filters filterStats
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		infos, other := parseSubfinderOutput(scanner.Text())
+		output.add(other...)
+
+		for _, info := range infos {
+			for _, source := range info.Sources {
+				sources.found(source, info.Subdomain)
+			}
 
-	// For now, we don't have a way to get the sources used from the CLI output
-	// In a real implementation, we would use the subfinder library directly
-	sourcesUsed := []string{"all"}
+			// Apply depth filtering if maxDepth is set and www filtering if excludeWww is set
+			if !filters.passes(info.Subdomain, domain, config) {
+				continue
+			}
 
-	c.logger.Printf("Found %d subdomains after filtering", len(subdomainInfos))
-	return subdomainInfos, sourcesUsed, nil
-}
+			filters.keep()
+			subdomainInfos = append(subdomainInfos, info)
+			if onResult != nil {
+				onResult(info)
+			}
+		}
+	}
+	scanErr := scanner.Err()
 
-// parseSubfinderOutput parses the output of subfinder into SubdomainInfo structs
-func parseSubfinderOutput(output string, includeIPs bool) []models.SubdomainInfo {
-	lines := strings.Split(strings.TrimSpace(output), "\n")
-	var results []models.SubdomainInfo
+	waitErr := cmd.Wait()
+	if cmd.ProcessState != nil {
+		metrics.ObserveRun("cli", cmd.ProcessState.ExitCode())
+		run.SetAttributes(attribute.Int("process.exit.code", cmd.ProcessState.ExitCode()))
+	}
+	if waitErr != nil {
+		tracing.Fail(run, waitErr)
+	}
+	run.End()
+	filters.trace(ctx)
 
+	// Keep banners, warnings and the statistics table in the job log
+	lines := strings.Split(stderr.String(), "\n")
+	statsTable := &statisticsParser{}
 	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-
-		parts := strings.Split(line, ",")
-		info := models.SubdomainInfo{}
+		statsTable.parseLine(line, sources)
+	}
+	output.add(lines...)
+	partial := &Result{Log: output.result()}
 
-		if len(parts) == 0 {
-			continue // Skip empty lines after split
+	if waitErr != nil {
+		c.logger.WarnContext(ctx, "Subfinder failed", "error", waitErr, "stderr", stderr.String())
+		if ctx.Err() != nil {
+			return partial, fmt.Errorf("subfinder canceled: %v", ctx.Err())
 		}
+		if _, ok := waitErr.(*exec.ExitError); ok {
+			return partial, fmt.Errorf("subfinder failed: %s", stderr.String())
+		}
+		return partial, fmt.Errorf("failed to run subfinder: %v, output: %s", waitErr, stderr.String())
+	}
+	if scanErr != nil {
+		return partial, fmt.Errorf("failed to read subfinder output: %v", scanErr)
+	}
 
-		info.Subdomain = parts[0]
+	// If IPs were not retrieved directly from the tool, resolve them manually
+	if config.IncludeIPs && !includeIPsFromTool {
+		c.logger.InfoContext(ctx, "Resolving IPs", "subdomains", len(subdomainInfos))
+		subdomainInfos = resolveIPs(ctx, subdomainInfos)
+	}
 
-		if includeIPs {
-			// Expect format: subdomain,ip[,source]
-			if len(parts) > 1 {
-				info.IP = parts[1]
-			}
-			if len(parts) > 2 {
-				info.Source = parts[2]
-			} else {
-				info.Source = "unknown" // Default if source is missing but IP is present
-			}
-		} else {
-			// Expect format: subdomain[,source]
-			if len(parts) > 1 {
-				info.Source = parts[1]
-			} else {
-				info.Source = "unknown" // Default if source is missing and no IP expected
-			}
-		}
-		results = append(results, info)
+	// Fall back to the requested sources if subfinder printed no statistics
+	sourcesUsed := sources.names()
+	if len(sourcesUsed) == 0 {
+		sourcesUsed = config.Sources
+	}
+	if len(sourcesUsed) == 0 {
+		sourcesUsed = []string{"all"}
 	}
 
-	return results
+	c.logger.InfoContext(ctx, "Found subdomains after filtering", "subdomains", len(subdomainInfos))
+	return &Result{
+		Subdomains:  subdomainInfos,
+		SourcesUsed: sourcesUsed,
+		Sources:     sources.list(),
+		Log:         partial.Log,
+	}, nil
 }
 
 // countDomainLevels counts the number of levels in a domain
@@ -173,60 +257,43 @@ func countDomainLevels(domain string) int {
 	return len(strings.Split(domain, "."))
 }
 
-// filterSubdomainsByDepth filters subdomains based on the max depth
-// baseDomain is the original domain (e.g., "example.com")
-// maxDepth is the maximum depth level (e.g., 1 would include only direct subdomains)
-func filterSubdomainsByDepth(subdomains []models.SubdomainInfo, baseDomain string, maxDepth int) []models.SubdomainInfo {
+// withinDepth reports whether subdomain is at most maxDepth levels below baseDomain.
+// A maxDepth of zero or less disables the check.
+func withinDepth(subdomain, baseDomain string, maxDepth int) bool {
 	if maxDepth <= 0 {
-		return subdomains // No filtering if maxDepth is not set
-	}
-
-	baseLevels := countDomainLevels(baseDomain)
-	maxLevels := baseLevels + maxDepth
-
-	var filtered []models.SubdomainInfo
-	for _, info := range subdomains {
-		if countDomainLevels(info.Subdomain) <= maxLevels {
-			filtered = append(filtered, info)
-		}
+		return true
 	}
-
-	return filtered
+	return countDomainLevels(subdomain) <= countDomainLevels(baseDomain)+maxDepth
 }
 
-// filterWwwSubdomains filters out www subdomains based on the configuration
-func filterWwwSubdomains(subdomains []models.SubdomainInfo, excludeWww bool) []models.SubdomainInfo {
-	if !excludeWww {
-		return subdomains // No filtering if excludeWww is false
-	}
-
-	var filtered []models.SubdomainInfo
-	for _, info := range subdomains {
-		if !strings.HasPrefix(info.Subdomain, "www.") {
-			filtered = append(filtered, info)
-		}
-	}
-
-	return filtered
+// isWwwSubdomain reports whether the subdomain has a www prefix
+func isWwwSubdomain(subdomain string) bool {
+	return strings.HasPrefix(subdomain, "www.")
 }
 
 // resolveIPs performs DNS lookups for each subdomain and fills the IP field.
 // Failures to resolve are ignored, leaving the IP field empty.
 func resolveIPs(ctx context.Context, infos []models.SubdomainInfo) []models.SubdomainInfo {
-	r := net.Resolver{}
+	ctx, span := tracing.Tracer().Start(ctx, "resolveIPs", trace.WithAttributes(attribute.Int("dns.lookups", len(infos))))
+	defer span.End()
+
+	r := &net.Resolver{}
+	resolved := 0
 	for i, info := range infos {
-		ips, err := r.LookupHost(ctx, info.Subdomain)
+		ips, err := lookupHost(ctx, r, info.Subdomain)
 		if err == nil && len(ips) > 0 {
 			infos[i].IP = ips[0]
+			resolved++
 		}
 	}
+	span.SetAttributes(attribute.Int("dns.resolved", resolved))
 	return infos
 }
 
-// Note: In a production environment, we would use the subfinder library directly
-// instead of executing the CLI. This implementation is a simplified version that
-// uses the CLI for demonstration purposes.
-//
-// To use the library directly, we would need to import:
-// "github.com/projectdiscovery/subfinder/v2/pkg/runner"
-// And then use the runner.New() and runner.RunEnumeration() functions.
+// lookupHost resolves a subdomain and records the latency of the lookup
+func lookupHost(ctx context.Context, r *net.Resolver, host string) ([]string, error) {
+	start := time.Now()
+	ips, err := r.LookupHost(ctx, host)
+	metrics.ObserveLookup(start, err)
+	return ips, err
+}
@@ -0,0 +1,306 @@
+package subfinder
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/projectdiscovery/gologger"
+	"github.com/projectdiscovery/gologger/levels"
+	"github.com/projectdiscovery/subfinder/v2/pkg/passive"
+	"github.com/projectdiscovery/subfinder/v2/pkg/subscraping"
+	mapsutil "github.com/projectdiscovery/utils/maps"
+	"github.com/user/subfinder-service/backend/internal/metrics"
+	"github.com/user/subfinder-service/backend/internal/tracing"
+	"github.com/user/subfinder-service/backend/pkg/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultMaxEnumerationTime bounds an enumeration when the job has no timeout
+const defaultMaxEnumerationTime = 10 * time.Minute
+
+// LibraryClient runs the subfinder passive sources in-process through the
+// subfinder Go library, which keeps the source of every result and the
+// errors reported by each source
+type LibraryClient struct {
+	providerConfig string
+	keys           KeySource
+	logger         *slog.Logger
+
+	// Current provider keys, keyed by lower-case source name. A new map is
+	// stored whenever the keys change, so every run keeps the keys it started with.
+	applied atomic.Pointer[map[string][]string]
+}
+
+// keysContextKey is the context key of the provider keys of a run
+type keysContextKey struct{}
+
+// wrapSources makes the shared sources of the library run on keys from the context
+var wrapSources sync.Once
+
+// NewLibraryClient creates a new library-based subfinder client. API keys for
+// the passive sources are loaded from providerConfig if the file exists. If
+// keys is not nil, its keys replace those of the file, and are loaded again
+// before every run.
+func NewLibraryClient(providerConfig string, keys KeySource, logger *slog.Logger) (*LibraryClient, error) {
+	// The library logs to stderr on its own; errors are reported through Result instead
+	gologger.DefaultLogger.SetMaxLevel(levels.LevelSilent)
+	wrapSources.Do(func() {
+		for i, source := range passive.AllSources {
+			keyed := &keyedSource{Source: source}
+			passive.AllSources[i] = keyed
+			passive.NameSourceMap[strings.ToLower(source.Name())] = keyed
+		}
+	})
+
+	client := &LibraryClient{
+		providerConfig: providerConfig,
+		keys:           keys,
+		logger:         logger,
+	}
+	if keys != nil {
+		if err := client.applyKeys(); err != nil {
+			logger.Warn("Failed to load provider keys, retrying before the first run", "error", err)
+		}
+		return client, nil
+	}
+
+	if err := client.applyKeys(); err != nil {
+		return nil, fmt.Errorf("failed to load provider config %s: %v", providerConfig, err)
+	}
+	if _, err := os.Stat(providerConfig); providerConfig != "" && err == nil {
+		logger.Info("Loaded subfinder provider config", "path", providerConfig)
+	}
+	return client, nil
+}
+
+// applyKeys loads the current provider keys for the next runs. Runs that
+// already started keep the keys they were given.
+func (c *LibraryClient) applyKeys() error {
+	keys, err := providerKeys(c.providerConfig, c.keys)
+	if err != nil {
+		return err
+	}
+	if applied := c.applied.Load(); applied == nil || !reflect.DeepEqual(keys, *applied) {
+		c.applied.Store(&keys)
+	}
+	return nil
+}
+
+// currentKeys returns the keys for a run, which must not be modified
+func (c *LibraryClient) currentKeys() map[string][]string {
+	if keys := c.applied.Load(); keys != nil {
+		return *keys
+	}
+	return nil
+}
+
+// keyedSource runs a new instance of a passive source for every run, with the
+// keys of the run, so that runs with different keys do not share the state the
+// library keeps in each source
+type keyedSource struct {
+	subscraping.Source
+}
+
+// Run implements subscraping.Source
+func (s *keyedSource) Run(ctx context.Context, domain string, session *subscraping.Session) <-chan subscraping.Result {
+	instance := reflect.New(reflect.TypeOf(s.Source).Elem()).Interface().(subscraping.Source)
+	keys, _ := ctx.Value(keysContextKey{}).(map[string][]string)
+	instance.AddApiKeys(keys[strings.ToLower(s.Name())])
+	return instance.Run(ctx, domain, session)
+}
+
+// FindSubdomains finds subdomains for the specified domain using the subfinder passive sources.
+// If onResult is not nil it is called for every new subdomain that passes the filters.
+func (c *LibraryClient) FindSubdomains(ctx context.Context, domain string, config models.SubfinderConfig, onResult func(models.SubdomainInfo)) (*Result, error) {
+	ctx, span := startFind(ctx, "library", domain)
+	result, err := c.find(ctx, domain, config, onResult)
+	endFind(span, result, err)
+	return result, err
+}
+
+// find runs the enumeration for FindSubdomains
+func (c *LibraryClient) find(ctx context.Context, domain string, config models.SubfinderConfig, onResult func(models.SubdomainInfo)) (*Result, error) {
+	c.logger.InfoContext(ctx, "Finding subdomains", "client", "library")
+
+	if c.keys != nil {
+		if err := c.applyKeys(); err != nil {
+			return nil, fmt.Errorf("failed to load provider keys: %v", err)
+		}
+	}
+
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	agent := passive.New(config.Sources, nil, config.IncludeWildcards, false)
+
+	// Apply the job rate limit to every source. The library only uses the
+	// global rate limit for sources that have a custom entry.
+	rateLimit := &subscraping.CustomRateLimit{
+		Custom: mapsutil.SyncLockMap[string, uint]{
+			Map: make(map[string]uint),
+		},
+	}
+	for name := range passive.NameSourceMap {
+		_ = rateLimit.Custom.Set(name, 0)
+	}
+
+	maxEnumTime := defaultMaxEnumerationTime
+	if config.Timeout > 0 {
+		maxEnumTime = time.Duration(config.Timeout) * time.Second
+	}
+
+	result := &Result{}
+	sources := newSourceCollector()
+	// Position of each reported subdomain in result.Subdomains, or -1 if it was filtered out
+	index := make(map[string]int)
+	resolver := &net.Resolver{}
+	var filters filterStats
+
+	// Trace the enumeration by the library from start to the last result
+	_, run := tracing.Tracer().Start(ctx, "subfinder enumerate", trace.WithAttributes(
+		attribute.StringSlice("subfinder.sources", config.Sources),
+	))
+	// The sources of this run use the keys current when it starts
+	keys := c.currentKeys()
+
+	// The sources keep their timing in the instances shared by all runs, so
+	// time each source of this run by its last result or error instead
+	start := time.Now()
+	lastReport := make(map[string]time.Time)
+	results := agent.EnumerateSubdomainsWithCtx(context.WithValue(ctx, keysContextKey{}, keys), domain, "", config.RateLimit, config.Timeout, maxEnumTime, passive.WithCustomRateLimit(rateLimit))
+	for res := range results {
+		if res.Source != "" {
+			lastReport[res.Source] = time.Now()
+		}
+		switch res.Type {
+		case subscraping.Error:
+			source := res.Source
+			if source == "" {
+				source = "subfinder"
+			}
+			sources.error(source, res.Error.Error())
+		case subscraping.Subdomain:
+			subdomain := strings.ReplaceAll(strings.ToLower(res.Value), "*.", "")
+			if !strings.HasSuffix(subdomain, "."+domain) {
+				continue
+			}
+			sources.found(res.Source, subdomain)
+
+			// Report each subdomain once and record the sources that found it later
+			if i, ok := index[subdomain]; ok {
+				if i >= 0 && !contains(result.Subdomains[i].Sources, res.Source) {
+					result.Subdomains[i].Sources = append(result.Subdomains[i].Sources, res.Source)
+				}
+				continue
+			}
+			index[subdomain] = -1
+
+			// Apply depth and www filtering
+			if !filters.passes(subdomain, domain, config) {
+				continue
+			}
+
+			info := models.SubdomainInfo{Subdomain: subdomain, Source: res.Source, Sources: []string{res.Source}}
+
+			// Resolve right away when unresolvable subdomains must be dropped
+			if config.ExcludeUnresolvable {
+				ips, err := lookupHost(ctx, resolver, subdomain)
+				if err != nil || len(ips) == 0 {
+					filters.dropUnresolvable()
+					continue
+				}
+				if config.IncludeIPs {
+					info.IP = ips[0]
+				}
+			}
+
+			filters.keep()
+			index[subdomain] = len(result.Subdomains)
+			result.Subdomains = append(result.Subdomains, info)
+			if onResult != nil {
+				onResult(info)
+			}
+		}
+	}
+
+	run.End()
+	filters.trace(ctx)
+
+	// The library has no exit code; report runs like a process that exited
+	// normally or was killed
+	if ctx.Err() != nil {
+		metrics.ObserveRun("library", -1)
+		return nil, fmt.Errorf("subfinder canceled: %v", ctx.Err())
+	}
+	metrics.ObserveRun("library", 0)
+
+	// Resolve IPs for the remaining subdomains if they were not resolved above
+	if config.IncludeIPs && !config.ExcludeUnresolvable {
+		c.logger.InfoContext(ctx, "Resolving IPs", "subdomains", len(result.Subdomains))
+		result.Subdomains = resolveIPs(ctx, result.Subdomains)
+	}
+
+	// List every selected source. Sources that reported nothing have no
+	// duration; those that need a key were skipped if none was set.
+	for name, at := range lastReport {
+		sources.source(name).Duration = at.Sub(start).Round(time.Millisecond).String()
+	}
+	for _, selected := range selectedSources(config) {
+		source := sources.source(selected.Name())
+		if selected.NeedsKey() && len(keys[strings.ToLower(selected.Name())]) == 0 {
+			source.SkippedMissingKey = true
+		}
+	}
+	result.SourcesUsed = sources.names()
+	result.Sources = sources.list()
+
+	for _, source := range result.Sources {
+		if source.Errors > 0 {
+			c.logger.WarnContext(ctx, "Source reported errors", "source", source.Source, "errors", source.Errors, "first_error", source.ErrorMessages[0])
+		}
+	}
+
+	c.logger.InfoContext(ctx, "Found subdomains after filtering", "subdomains", len(result.Subdomains), "sources", len(result.SourcesUsed))
+	return result, nil
+}
+
+// selectedSources returns the sources the library runs for config, chosen
+// like passive.New does
+func selectedSources(config models.SubfinderConfig) []subscraping.Source {
+	if config.IncludeWildcards {
+		return passive.AllSources[:]
+	}
+
+	var selected []subscraping.Source
+	if len(config.Sources) > 0 {
+		for _, name := range config.Sources {
+			if source := passive.NameSourceMap[name]; source != nil {
+				selected = append(selected, source)
+			}
+		}
+		return selected
+	}
+	for _, source := range passive.AllSources {
+		if source.IsDefault() {
+			selected = append(selected, source)
+		}
+	}
+	return selected
+}
+
+// contains reports whether values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package subfinder
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/projectdiscovery/subfinder/v2/pkg/subscraping"
+)
+
+// keySource returns the keys stored in it
+type keySource struct {
+	mu   sync.Mutex
+	keys map[string][]string
+}
+
+// ProviderKeys implements KeySource
+func (s *keySource) ProviderKeys() (map[string][]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys, nil
+}
+
+// set replaces the stored keys
+func (s *keySource) set(keys map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+// echoSource is a passive source that reports its API keys as results
+type echoSource struct {
+	apiKeys []string
+}
+
+func (s *echoSource) Run(context.Context, string, *subscraping.Session) <-chan subscraping.Result {
+	results := make(chan subscraping.Result)
+	go func() {
+		defer close(results)
+		for _, key := range s.apiKeys {
+			results <- subscraping.Result{Source: s.Name(), Type: subscraping.Subdomain, Value: key}
+		}
+	}()
+	return results
+}
+
+func (s *echoSource) Name() string                       { return "Echo" }
+func (s *echoSource) IsDefault() bool                    { return false }
+func (s *echoSource) HasRecursiveSupport() bool          { return false }
+func (s *echoSource) NeedsKey() bool                     { return true }
+func (s *echoSource) AddApiKeys(keys []string)           { s.apiKeys = keys }
+func (s *echoSource) Statistics() subscraping.Statistics { return subscraping.Statistics{} }
+
+func TestRunsKeepTheirProviderKeys(t *testing.T) {
+	keys := &keySource{keys: map[string][]string{"echo": {"first"}}}
+	client, err := NewLibraryClient("", keys, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := &echoSource{}
+	source := &keyedSource{Source: shared}
+
+	// A run in progress keeps its keys when they change and the next run starts
+	started := client.currentKeys()
+	keys.set(map[string][]string{"echo": {"second"}})
+	if err := client.applyKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	got := make([][]string, 2)
+	for i, runKeys := range []map[string][]string{started, client.currentKeys()} {
+		i, runKeys := i, runKeys
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := context.WithValue(context.Background(), keysContextKey{}, runKeys)
+			for result := range source.Run(ctx, "example.com", nil) {
+				got[i] = append(got[i], result.Value)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if want := [][]string{{"first"}, {"second"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("runs used keys %v, want %v", got, want)
+	}
+	if shared.apiKeys != nil {
+		t.Errorf("keys %v given to the shared source instance", shared.apiKeys)
+	}
+}
@@ -0,0 +1,146 @@
+package subfinder
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// jsonRecord is a single result written by subfinder with -oJ. With -cs all
+// sources are listed in Sources, otherwise only Source is set.
+type jsonRecord struct {
+	Host    string   `json:"host"`
+	Input   string   `json:"input"`
+	IP      string   `json:"ip"`
+	Source  string   `json:"source"`
+	Sources []string `json:"sources"`
+}
+
+// sources returns every source that reported the record
+func (r jsonRecord) sources() []string {
+	if len(r.Sources) > 0 {
+		return r.Sources
+	}
+	if r.Source != "" {
+		return []string{r.Source}
+	}
+	return nil
+}
+
+// decodeRecord decodes a JSON line written by subfinder. It returns false for
+// lines that are not result records.
+func decodeRecord(line string) (jsonRecord, bool) {
+	var record jsonRecord
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return record, false
+	}
+	if err := json.Unmarshal([]byte(line), &record); err != nil || record.Host == "" {
+		return record, false
+	}
+	return record, true
+}
+
+// info converts the record to a SubdomainInfo
+func (r jsonRecord) info() models.SubdomainInfo {
+	info := models.SubdomainInfo{
+		Subdomain: r.Host,
+		IP:        r.IP,
+		Sources:   r.sources(),
+	}
+	if len(info.Sources) > 0 {
+		info.Source = info.Sources[0]
+	}
+	return info
+}
+
+// parseSubfinderOutput parses the JSON output of subfinder into SubdomainInfo
+// structs. Lines that are not JSON records are returned separately so they can
+// be kept in the job log.
+func parseSubfinderOutput(output string) ([]models.SubdomainInfo, []string) {
+	var results []models.SubdomainInfo
+	var other []string
+
+	for _, line := range strings.Split(output, "\n") {
+		record, ok := decodeRecord(line)
+		if !ok {
+			if strings.TrimSpace(line) != "" {
+				other = append(other, line)
+			}
+			continue
+		}
+		results = append(results, record.info())
+	}
+
+	return results, other
+}
+
+// maxLogLines is the number of diagnostic lines kept per job
+const maxLogLines = 500
+
+// jobLog collects diagnostic output lines up to maxLogLines
+type jobLog struct {
+	lines     []string
+	truncated int
+}
+
+// add appends lines to the log, counting the ones that no longer fit
+func (l *jobLog) add(lines ...string) {
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if len(l.lines) >= maxLogLines {
+			l.truncated++
+			continue
+		}
+		l.lines = append(l.lines, line)
+	}
+}
+
+// result returns the collected lines, noting how many were dropped
+func (l *jobLog) result() []string {
+	if l.truncated > 0 {
+		return append(l.lines, fmt.Sprintf("... %d more line(s) truncated", l.truncated))
+	}
+	return l.lines
+}
+
+// statisticsLine matches a row of the table printed by subfinder with -stats:
+// source, duration, results and errors
+var statisticsLine = regexp.MustCompile(`^\s*(\S+)\s+(\S+)\s+(\d+)\s+(\d+)\s*$`)
+
+// statisticsParser reads the source statistics printed by subfinder with -stats
+type statisticsParser struct {
+	inSkipped bool
+}
+
+// parseLine adds the statistics found in a non-JSON output line to the collector
+func (p *statisticsParser) parseLine(line string, sources *sourceCollector) {
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case trimmed == "":
+		return
+	case strings.HasPrefix(trimmed, "The following sources were included but skipped"):
+		p.inSkipped = true
+	case p.inSkipped:
+		if !strings.ContainsAny(trimmed, " \t") {
+			sources.source(trimmed).SkippedMissingKey = true
+		}
+	default:
+		match := statisticsLine.FindStringSubmatch(line)
+		if match == nil {
+			return
+		}
+		source := sources.source(match[1])
+		source.Duration = match[2]
+		if errors, err := strconv.Atoi(match[4]); err == nil {
+			source.Errors = errors
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package subfinder
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+func TestStatisticsParserReadsStatsOutput(t *testing.T) {
+	// stderr of subfinder v2.6.3 run with -stats -nc
+	data, err := os.ReadFile("testdata/stats.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sources := newSourceCollector()
+	parser := &statisticsParser{}
+	for _, line := range strings.Split(string(data), "\n") {
+		parser.parseLine(line, sources)
+	}
+
+	stats := make(map[string]models.SourceStats)
+	for _, source := range sources.list() {
+		stats[source.Source] = source
+	}
+
+	if len(stats) != 4 {
+		t.Errorf("parsed %d sources, want 4: %v", len(stats), stats)
+	}
+	if s := stats["crtsh"]; s.Duration != "1ms" || s.Errors != 2 || s.SkippedMissingKey {
+		t.Errorf("crtsh: got %+v, want 1ms with 2 errors", s)
+	}
+	if s := stats["alienvault"]; s.Duration != "2ms" || s.Errors != 1 {
+		t.Errorf("alienvault: got %+v, want 2ms with 1 error", s)
+	}
+	if s := stats["github"]; !s.SkippedMissingKey {
+		t.Errorf("github: got %+v, want skipped for a missing key", s)
+	}
+}
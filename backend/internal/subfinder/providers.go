@@ -0,0 +1,88 @@
+package subfinder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/projectdiscovery/subfinder/v2/pkg/passive"
+	fileutil "github.com/projectdiscovery/utils/file"
+	"gopkg.in/yaml.v3"
+)
+
+// KeySource provides API keys for the passive sources
+type KeySource interface {
+	// ProviderKeys returns the API keys of each source, keyed by lower-case source name
+	ProviderKeys() (map[string][]string, error)
+}
+
+// KeySources returns the names of the passive sources that need an API key
+func KeySources() []string {
+	var names []string
+	for _, source := range passive.AllSources {
+		if source.NeedsKey() {
+			names = append(names, strings.ToLower(source.Name()))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// providerKeys returns the keys of the provider config file at path, replaced
+// per source by the keys from keys. A missing file or a nil keys contributes no keys.
+func providerKeys(path string, keys KeySource) (map[string][]string, error) {
+	merged := make(map[string][]string)
+	if path != "" {
+		if _, err := os.Stat(path); err == nil {
+			reader, err := fileutil.SubstituteConfigFromEnvVars(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read provider config %s: %v", path, err)
+			}
+			if err := yaml.NewDecoder(reader).Decode(merged); err != nil {
+				return nil, fmt.Errorf("failed to parse provider config %s: %v", path, err)
+			}
+		}
+	}
+
+	if keys == nil {
+		return merged, nil
+	}
+	stored, err := keys.ProviderKeys()
+	if err != nil {
+		return nil, err
+	}
+	for source, values := range stored {
+		if len(values) > 0 {
+			merged[source] = values
+		}
+	}
+	return merged, nil
+}
+
+// writeProviderConfig writes keys to a new temporary provider config file
+// readable only by the current user and returns its path. The caller must
+// remove the file.
+func writeProviderConfig(keys map[string][]string) (string, error) {
+	// JSON is valid YAML, which is what subfinder expects
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp("", "subfinder-provider-config-*.yaml")
+	if err != nil {
+		return "", fmt.Errorf("failed to create provider config: %v", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write provider config: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write provider config: %v", err)
+	}
+	return file.Name(), nil
+}
@@ -0,0 +1,75 @@
+package subfinder
+
+import (
+	"sort"
+
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// maxErrorMessages is the number of error messages kept per source
+const maxErrorMessages = 5
+
+// sourceCollector accumulates per-source statistics during an enumeration
+type sourceCollector struct {
+	stats map[string]*models.SourceStats
+	hosts map[string]map[string]struct{}
+}
+
+// newSourceCollector creates an empty collector
+func newSourceCollector() *sourceCollector {
+	return &sourceCollector{
+		stats: make(map[string]*models.SourceStats),
+		hosts: make(map[string]map[string]struct{}),
+	}
+}
+
+// source returns the statistics entry for a source, creating it if needed
+func (c *sourceCollector) source(name string) *models.SourceStats {
+	stats, ok := c.stats[name]
+	if !ok {
+		stats = &models.SourceStats{Source: name}
+		c.stats[name] = stats
+	}
+	return stats
+}
+
+// found records that a source reported a subdomain
+func (c *sourceCollector) found(name, host string) {
+	stats := c.source(name)
+	if c.hosts[name] == nil {
+		c.hosts[name] = make(map[string]struct{})
+	}
+	if _, ok := c.hosts[name][host]; !ok {
+		c.hosts[name][host] = struct{}{}
+		stats.Found++
+	}
+}
+
+// error records an error reported by a source
+func (c *sourceCollector) error(name, message string) {
+	stats := c.source(name)
+	stats.Errors++
+	if len(stats.ErrorMessages) < maxErrorMessages {
+		stats.ErrorMessages = append(stats.ErrorMessages, message)
+	}
+}
+
+// names returns the names of all sources seen, sorted
+func (c *sourceCollector) names() []string {
+	names := make([]string, 0, len(c.stats))
+	for name := range c.stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// list returns the statistics of all sources, sorted by name
+func (c *sourceCollector) list() []models.SourceStats {
+	names := c.names()
+	list := make([]models.SourceStats, 0, len(names))
+	for _, name := range names {
+		list = append(list, *c.stats[name])
+	}
+	return list
+}
@@ -0,0 +1,90 @@
+package subfinder
+
+import (
+	"context"
+	"time"
+
+	"github.com/user/subfinder-service/backend/internal/tracing"
+	"github.com/user/subfinder-service/backend/pkg/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startFind starts the span of an enumeration
+func startFind(ctx context.Context, client, domain string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "FindSubdomains", trace.WithAttributes(
+		attribute.String("subfinder.client", client),
+		attribute.String("job.domain", domain),
+	))
+}
+
+// endFind records the outcome of an enumeration on its span and ends it
+func endFind(span trace.Span, result *Result, err error) {
+	if err != nil {
+		tracing.Fail(span, err)
+	} else if result != nil {
+		span.SetAttributes(attribute.Int("subfinder.subdomains", len(result.Subdomains)))
+	}
+	span.End()
+}
+
+// filterStats counts the subdomains dropped by the filters of a job. The
+// filters run on each subdomain as subfinder reports it, so the span they
+// are traced with covers the time from the first to the last filtered subdomain.
+type filterStats struct {
+	first, last  time.Time
+	kept         int
+	depth        int
+	www          int
+	unresolvable int
+}
+
+// passes applies the depth and www filters of config to a subdomain of domain
+func (f *filterStats) passes(subdomain, domain string, config models.SubfinderConfig) bool {
+	defer f.touch()
+
+	if !withinDepth(subdomain, domain, config.MaxDepth) {
+		f.depth++
+		return false
+	}
+	if config.ExcludeWww && isWwwSubdomain(subdomain) {
+		f.www++
+		return false
+	}
+	return true
+}
+
+// dropUnresolvable counts a subdomain dropped because it does not resolve
+func (f *filterStats) dropUnresolvable() {
+	f.unresolvable++
+	f.touch()
+}
+
+// keep counts a subdomain that passed all filters
+func (f *filterStats) keep() {
+	f.kept++
+	f.touch()
+}
+
+// touch extends the time covered by the filters to now
+func (f *filterStats) touch() {
+	now := time.Now()
+	if f.first.IsZero() {
+		f.first = now
+	}
+	f.last = now
+}
+
+// trace records the filters as a span of ctx, if any subdomain was filtered
+func (f *filterStats) trace(ctx context.Context) {
+	if f.first.IsZero() {
+		return
+	}
+	_, span := tracing.Tracer().Start(ctx, "filter subdomains", trace.WithTimestamp(f.first), trace.WithAttributes(
+		attribute.Int("filter.kept", f.kept),
+		attribute.Int("filter.dropped_depth", f.depth),
+		attribute.Int("filter.dropped_www", f.www),
+		attribute.Int("filter.dropped_unresolvable", f.unresolvable),
+	))
+	span.End(trace.WithTimestamp(f.last))
+}
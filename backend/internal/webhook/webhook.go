@@ -0,0 +1,276 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/user/subfinder-service/backend/internal/queue"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// Headers sent with every notification
+const (
+	SignatureHeader = "X-Subfinder-Signature"
+	TimestampHeader = "X-Subfinder-Timestamp"
+	EventHeader     = "X-Subfinder-Event"
+)
+
+// Delivery settings
+const (
+	maxAttempts    = 5
+	initialBackoff = 2 * time.Second
+	requestTimeout = 10 * time.Second
+)
+
+// ErrForbiddenAddress is returned for callbacks to hosts inside the service's network
+var ErrForbiddenAddress = errors.New("callbacks to loopback, private and link-local addresses are not allowed")
+
+// blockedPrefixes are ranges that are not public but not covered by the checks
+// of netip.Addr: "this network", which reaches the local host, and carrier-grade NAT
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// Payload is the JSON body posted to the callback URL
+type Payload struct {
+	Event       string           `json:"event"`
+	JobID       string           `json:"job_id"`
+	Domain      string           `json:"domain"`
+	Status      models.JobStatus `json:"status"`
+	CreatedAt   time.Time        `json:"created_at"`
+	CompletedAt *time.Time       `json:"completed_at,omitempty"`
+	Error       string           `json:"error,omitempty"`
+	Stats       *models.JobStats `json:"stats,omitempty"`
+}
+
+// Notifier posts signed notifications to job callback URLs when jobs finish
+type Notifier struct {
+	queue  *queue.JobQueue
+	client *http.Client
+	logger *slog.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewNotifier creates a notifier and registers it for the events of the queue.
+// Notifications are never sent to loopback, private or link-local addresses,
+// whatever the callback host resolves to.
+func NewNotifier(jobQueue *queue.JobQueue, logger *slog.Logger) *Notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	dialer := &net.Dialer{
+		Timeout: requestTimeout,
+		Control: checkDial,
+	}
+	n := &Notifier{
+		queue: jobQueue,
+		client: &http.Client{
+			Timeout: requestTimeout,
+			// No proxy, so that the address checked when dialing is the callback's
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: requestTimeout,
+			},
+		},
+		logger: logger,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	jobQueue.Listen(func(id string, event queue.Event) {
+		if event.Type == queue.EventStatus && event.Status.IsFinal() {
+			n.wg.Add(1)
+			go n.deliver(id)
+		}
+	})
+
+	return n
+}
+
+// Close stops pending retries and waits for in-flight deliveries to finish
+func (n *Notifier) Close() {
+	n.cancel()
+	n.wg.Wait()
+}
+
+// ValidateURL checks that a callback URL is an absolute http or https URL
+// that does not name a loopback, private or link-local host. Host names are
+// checked again against the addresses they resolve to when notifying.
+func ValidateURL(callbackURL string) error {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return fmt.Errorf("invalid callback URL: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid callback URL %q: must be an absolute http or https URL", callbackURL)
+	}
+
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return fmt.Errorf("invalid callback URL %q: %w", callbackURL, ErrForbiddenAddress)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !allowed(ip) {
+		return fmt.Errorf("invalid callback URL %q: %w", callbackURL, ErrForbiddenAddress)
+	}
+	return nil
+}
+
+// checkDial rejects connections to addresses that are not allowed. It runs
+// after the host name is resolved, so names resolving to internal addresses
+// and redirects to them are caught as well.
+func checkDial(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !allowed(addrPort.Addr()) {
+		return fmt.Errorf("%s: %w", address, ErrForbiddenAddress)
+	}
+	return nil
+}
+
+// allowed reports whether notifications may be sent to ip
+func allowed(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of timestamp, a dot and body, as
+// sent in SignatureHeader with a "sha256=" prefix. timestamp is the value of
+// TimestampHeader, so that receivers can reject replayed notifications.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver sends the notification of a job, retrying with exponential backoff
+func (n *Notifier) deliver(id string) {
+	defer n.wg.Done()
+
+	// The payload needs no results, so the summary is enough
+	summaries := n.queue.GetSummaries([]string{id})
+	if len(summaries) == 0 {
+		return
+	}
+	job := summaries[0]
+	if job.Webhook == nil || job.Webhook.Delivered {
+		return
+	}
+	logger := n.logger.With("job_id", id, "domain", job.Domain, "url", job.Webhook.URL)
+
+	payload := Payload{
+		Event:       "job." + string(job.Status),
+		JobID:       job.ID,
+		Domain:      job.Domain,
+		Status:      job.Status,
+		CreatedAt:   job.CreatedAt,
+		CompletedAt: job.CompletedAt,
+		Error:       job.Error,
+		Stats:       job.Stats,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logger.Error("Failed to encode webhook payload", "error", err)
+		return
+	}
+
+	backoff := initialBackoff
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		result := n.post(job.Webhook, payload.Event, body)
+		delivered := result.Error == "" && result.StatusCode >= 200 && result.StatusCode < 300
+		n.record(id, result, delivered)
+
+		if delivered {
+			logger.Info("Delivered webhook")
+			return
+		}
+		logger.Warn("Webhook attempt failed", "attempt", attempt, "max_attempts", maxAttempts, "status", result.StatusCode, "error", result.Error)
+
+		if attempt == maxAttempts {
+			break
+		}
+		select {
+		case <-n.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	logger.Error("Giving up on webhook", "attempts", maxAttempts)
+}
+
+// post makes a single delivery attempt
+func (n *Notifier) post(webhook *models.Webhook, event string, body []byte) models.WebhookAttempt {
+	attempt := models.WebhookAttempt{Time: time.Now()}
+
+	req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	timestamp := strconv.FormatInt(attempt.Time.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(TimestampHeader, timestamp)
+	if webhook.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(webhook.Secret, timestamp, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("unexpected status %s", resp.Status)
+	}
+	return attempt
+}
+
+// record stores a delivery attempt on the job
+func (n *Notifier) record(id string, attempt models.WebhookAttempt, delivered bool) {
+	_, err := n.queue.Update(id, func(job *models.Job) error {
+		if job.Webhook != nil {
+			job.Webhook.Attempts = append(job.Webhook.Attempts, attempt)
+			job.Webhook.Delivered = delivered
+		}
+		return nil
+	})
+	if err != nil && err != queue.ErrJobNotFound {
+		n.logger.Error("Failed to record webhook attempt", "job_id", id, "error", err)
+	}
+}
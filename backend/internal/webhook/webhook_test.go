@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/user/subfinder-service/backend/internal/queue"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+func TestValidateURLRejectsInternalHosts(t *testing.T) {
+	for _, callback := range []string{
+		"http://localhost:8080/hook",
+		"http://127.0.0.1/hook",
+		"http://10.1.2.3/hook",
+		"http://172.16.0.1/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0:8080/hook",
+		"http://100.64.0.1/hook",
+		"http://[::1]/hook",
+		"http://[fd00::1]/hook",
+		"http://[fe80::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+	} {
+		if err := ValidateURL(callback); !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("%s: got %v, want ErrForbiddenAddress", callback, err)
+		}
+	}
+
+	for _, callback := range []string{"https://hooks.example.com/subfinder", "http://93.184.216.34/hook"} {
+		if err := ValidateURL(callback); err != nil {
+			t.Errorf("%s: %v", callback, err)
+		}
+	}
+}
+
+func TestNotifierDoesNotDialInternalAddresses(t *testing.T) {
+	called := make(chan struct{}, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called <- struct{}{}
+	}))
+	defer receiver.Close()
+
+	q := queue.NewJobQueue(queue.NewMemoryStore(), queue.DefaultCapacity)
+	n := NewNotifier(q, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer n.Close()
+
+	// Like a host name that resolves to the loopback address, the URL is not
+	// checked by ValidateURL here, so connecting must be refused
+	attempt := n.post(&models.Webhook{URL: receiver.URL}, "job.completed", []byte("{}"))
+	if attempt.Error == "" {
+		t.Fatal("notification to a loopback address was sent")
+	}
+	select {
+	case <-called:
+		t.Error("receiver on a loopback address was called")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDeliverSignsTimestampAndBody(t *testing.T) {
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan request, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{r.Header, body}
+	}))
+	defer receiver.Close()
+
+	store := queue.NewMemoryStore()
+	completedAt := time.Now()
+	err := store.Save(&models.Job{
+		ID:          "job",
+		Domain:      "example.com",
+		Status:      models.JobStatusCompleted,
+		CreatedAt:   completedAt.Add(-time.Minute),
+		CompletedAt: &completedAt,
+		Subdomains:  []models.SubdomainInfo{{Subdomain: "www.example.com"}},
+		Webhook:     &models.Webhook{URL: receiver.URL, Secret: "secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := queue.NewJobQueue(store, queue.DefaultCapacity)
+	n := NewNotifier(q, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer n.Close()
+	// The receiver listens on the loopback address
+	n.client = receiver.Client()
+
+	n.wg.Add(1)
+	n.deliver("job")
+
+	received := <-requests
+	timestamp := received.header.Get(TimestampHeader)
+	at, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(at, 0)) > time.Minute {
+		t.Errorf("got timestamp %q", timestamp)
+	}
+	if got, want := received.header.Get(SignatureHeader), "sha256="+Sign("secret", timestamp, received.body); got != want {
+		t.Errorf("got signature %q, want %q", got, want)
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(received.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != "job.completed" || payload.JobID != "job" || payload.Domain != "example.com" {
+		t.Errorf("got payload %+v", payload)
+	}
+	if job, _ := q.Get("job"); !job.Webhook.Delivered || len(job.Subdomains) != 1 {
+		t.Errorf("delivery not recorded or results lost: %+v", job)
+	}
+}
@@ -2,38 +2,48 @@ package worker
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
+	"github.com/user/subfinder-service/backend/internal/diff"
+	"github.com/user/subfinder-service/backend/internal/logging"
+	"github.com/user/subfinder-service/backend/internal/metrics"
 	"github.com/user/subfinder-service/backend/internal/queue"
 	"github.com/user/subfinder-service/backend/internal/subfinder"
+	"github.com/user/subfinder-service/backend/internal/tracing"
 	"github.com/user/subfinder-service/backend/pkg/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // WorkerPool represents a pool of workers that process jobs from a queue
 type WorkerPool struct {
 	count     int
 	queue     *queue.JobQueue
-	logger    *log.Logger
+	logger    *slog.Logger
 	wg        sync.WaitGroup
-	subfinder *subfinder.Client
+	subfinder subfinder.Enumerator
 }
 
 // NewWorkerPool creates a new worker pool with the specified number of workers
-func NewWorkerPool(count int, queue *queue.JobQueue, logger *log.Logger) *WorkerPool {
+func NewWorkerPool(count int, queue *queue.JobQueue, enumerator subfinder.Enumerator, logger *slog.Logger) *WorkerPool {
 	return &WorkerPool{
 		count:     count,
 		queue:     queue,
 		logger:    logger,
-		subfinder: subfinder.NewClient(logger),
+		subfinder: enumerator,
 	}
 }
 
 // Start starts the worker pool
 func (p *WorkerPool) Start(ctx context.Context) {
-	p.logger.Printf("Starting worker pool with %d workers", p.count)
+	p.logger.Info("Starting worker pool", "workers", p.count)
 
+	metrics.Workers.WithLabelValues(metrics.WorkerBusy).Set(0)
+	metrics.Workers.WithLabelValues(metrics.WorkerIdle).Add(float64(p.count))
 	for i := 0; i < p.count; i++ {
 		p.wg.Add(1)
 		go p.worker(ctx, i)
@@ -47,93 +57,299 @@ func (p *WorkerPool) Wait() {
 
 // worker processes jobs from the queue
 func (p *WorkerPool) worker(ctx context.Context, id int) {
+	ctx = logging.With(ctx, "worker_id", id)
 	defer func() {
 		if r := recover(); r != nil {
-			p.logger.Printf("Worker %d recovered from panic: %v", id, r)
+			p.logger.ErrorContext(ctx, "Worker recovered from panic", "panic", r)
 		}
+		metrics.Workers.WithLabelValues(metrics.WorkerIdle).Dec()
 		p.wg.Done()
 	}()
 
-	p.logger.Printf("Worker %d started", id)
+	p.logger.InfoContext(ctx, "Worker started")
 
 	for {
-		select {
-		case <-ctx.Done():
-			p.logger.Printf("Worker %d stopped", id)
+		// Wait for a job or for the pool to stop
+		jobID, err := p.queue.Dequeue(ctx)
+		if err != nil {
+			p.logger.InfoContext(ctx, "Worker stopped")
 			return
-		default:
-			// Try to get a job from the queue
-			jobID, ok := p.queue.Dequeue()
-			if !ok {
-				// No jobs in the queue, wait a bit and try again
-				time.Sleep(100 * time.Millisecond)
-				continue
-			}
-			p.logger.Printf("Worker %d dequeued job %s", id, jobID)
-
-			// Get the job from the queue
-			job, ok := p.queue.Get(jobID)
-			if !ok {
-				p.logger.Printf("Worker %d: Job %s not found", id, jobID)
-				continue
-			}
-
-			// Process the job
-			p.processJob(ctx, job)
 		}
+		p.logger.DebugContext(ctx, "Worker dequeued job", "job_id", jobID)
+
+		// Process the job
+		p.processJob(ctx, jobID)
 	}
 }
 
+// errNotQueued reports that a dequeued job no longer waits to be processed
+var errNotQueued = errors.New("job is no longer queued")
+
 // processJob processes a job
-func (p *WorkerPool) processJob(ctx context.Context, job *models.Job) {
-	p.logger.Printf("Processing job %s for domain %s with config %+v", job.ID, job.Domain, job.Config)
+func (p *WorkerPool) processJob(ctx context.Context, id string) {
+	ctx = logging.With(ctx, "job_id", id)
+
+	// Register a per-job context so the job can be canceled through the API
+	jobCtx, cancelJob := context.WithCancelCause(ctx)
+	defer cancelJob(nil)
+	p.queue.Track(id, cancelJob)
+	defer p.queue.Untrack(id)
+
+	// Update job status to running, unless it was canceled while waiting in the queue
+	job, err := p.queue.Update(id, func(job *models.Job) error {
+		if job.Status != models.JobStatusQueued {
+			return fmt.Errorf("%w: status %s", errNotQueued, job.Status)
+		}
+
+		now := time.Now()
+		job.Status = models.JobStatusRunning
+		job.StartedAt = &now
+
+		// Estimate completion time based on domain complexity
+		// This is a simple estimation, could be improved with historical data
+		estimatedDuration := 30 * time.Second // Default estimation
+		estimatedCompletionTime := now.Add(estimatedDuration)
+		job.EstimatedCompletionTime = &estimatedCompletionTime
+		return nil
+	})
+	if err != nil {
+		p.logger.InfoContext(ctx, "Skipping job", "error", err)
+		return
+	}
+	jobCtx = logging.With(jobCtx, "domain", job.Domain)
 
-	// Update job status to running
-	now := time.Now()
-	job.Status = models.JobStatusRunning
-	job.StartedAt = &now
+	// Count the worker as busy while the job runs
+	metrics.Workers.WithLabelValues(metrics.WorkerIdle).Dec()
+	metrics.Workers.WithLabelValues(metrics.WorkerBusy).Inc()
+	defer func() {
+		metrics.Workers.WithLabelValues(metrics.WorkerBusy).Dec()
+		metrics.Workers.WithLabelValues(metrics.WorkerIdle).Inc()
+	}()
 
-	// Estimate completion time based on domain complexity
-	// This is a simple estimation, could be improved with historical data
-	estimatedDuration := 30 * time.Second // Default estimation
-	estimatedCompletionTime := now.Add(estimatedDuration)
-	job.EstimatedCompletionTime = &estimatedCompletionTime
-	p.logger.Printf("Job %s estimated completion at %s", job.ID, estimatedCompletionTime.Format(time.RFC3339))
+	// Continue the trace of the submission. Jobs without one, such as scheduled
+	// jobs, start a new trace that also holds their queue wait.
+	parent := tracing.Extract(jobCtx, job.TraceContext)
+	attributes := trace.WithAttributes(
+		attribute.String("job.id", job.ID),
+		attribute.String("job.domain", job.Domain),
+		attribute.String("job.priority", string(job.Priority)),
+	)
+	jobCtx, span := tracing.Tracer().Start(parent, "process job", trace.WithTimestamp(*job.StartedAt), attributes)
+	defer span.End()
+	if len(job.TraceContext) == 0 {
+		parent = jobCtx
+	}
+	_, wait := tracing.Tracer().Start(parent, "queue wait", trace.WithTimestamp(job.CreatedAt), attributes)
+	wait.End(trace.WithTimestamp(*job.StartedAt))
+	traceID := span.SpanContext().TraceID().String()
 
-	p.queue.Update(job)
+	p.logger.InfoContext(jobCtx, "Processing job", "config", job.Config, "estimated_completion_time", job.EstimatedCompletionTime)
+	p.queue.Publish(job.ID, queue.Event{Type: queue.EventStatus, Status: job.Status})
 
 	// Create a context with timeout from the job configuration
-	jobCtx := ctx
 	if job.Config.Timeout > 0 {
 		var cancel context.CancelFunc
-		jobCtx, cancel = context.WithTimeout(ctx, time.Duration(job.Config.Timeout)*time.Second)
+		jobCtx, cancel = context.WithTimeout(jobCtx, time.Duration(job.Config.Timeout)*time.Second)
 		defer cancel()
-		p.logger.Printf("Job %s timeout set to %ds", job.ID, job.Config.Timeout)
+		p.logger.DebugContext(jobCtx, "Job timeout set", "timeout", time.Duration(job.Config.Timeout)*time.Second)
 	}
 
 	// Run subfinder
 	startTime := time.Now()
-	subdomains, sourcesUsed, err := p.subfinder.FindSubdomains(jobCtx, job.Domain, job.Config)
+	partial := p.bufferResults(jobCtx, id)
+	result, err := p.subfinder.FindSubdomains(jobCtx, job.Domain, job.Config, func(info models.SubdomainInfo) {
+		// Stream every result right away and store partial results in batches
+		p.queue.Publish(id, queue.Event{Type: queue.EventSubdomain, Subdomain: info})
+		partial.add(info)
+	})
 	executionTime := time.Since(startTime)
+	unsaved := partial.stop()
+	canceled := err != nil && errors.Is(context.Cause(jobCtx), queue.ErrJobCanceled)
+
+	status := models.JobStatusCompleted
+	if canceled {
+		status = models.JobStatusCanceled
+	} else if err != nil {
+		status = models.JobStatusFailed
+	}
+	metrics.JobDuration.WithLabelValues(string(status)).Observe(executionTime.Seconds())
+	span.SetAttributes(attribute.String("job.status", string(status)))
+	if status == models.JobStatusCompleted {
+		metrics.SubdomainsFound.Observe(float64(len(result.Subdomains)))
+		span.SetAttributes(attribute.Int("job.subdomains", len(result.Subdomains)))
+	} else {
+		tracing.Fail(span, err)
+	}
+
+	// Compare with the previous scan of the same domain before taking the queue
+	// lock, since it reads the previous job with all its subdomains
+	completedAt := time.Now()
+	var jobDiff *models.JobDiff
+	if status == models.JobStatusCompleted {
+		jobDiff = p.compareWithPrevious(jobCtx, job, result.Subdomains, completedAt)
+	}
 
 	// Update job with results
-	now = time.Now()
-	job.CompletedAt = &now
+	job = p.updateJob(jobCtx, id, func(job *models.Job) {
+		job.CompletedAt = &completedAt
+		if job.TraceID == "" {
+			job.TraceID = traceID
+		}
+		if result != nil {
+			job.Log = result.Log
+		}
 
-	if err != nil {
-		job.Status = models.JobStatusFailed
-		job.Error = err.Error()
-		p.logger.Printf("Job %s failed after %s: %v", job.ID, executionTime.String(), err)
-	} else {
-		job.Status = models.JobStatusCompleted
-		job.Subdomains = subdomains
-		job.Stats = &models.JobStats{
-			TotalFound:    len(subdomains),
-			ExecutionTime: executionTime.String(),
-			SourcesUsed:   sourcesUsed,
+		// The complete results of a finished job are stored once below; jobs
+		// that did not finish keep the partial results found until they stopped
+		if canceled || err != nil {
+			job.Subdomains = append(job.Subdomains, unsaved...)
+		}
+
+		if canceled {
+			job.Status = models.JobStatusCanceled
+			job.Error = queue.ErrJobCanceled.Error()
+			p.logger.InfoContext(jobCtx, "Job canceled", "duration", executionTime)
+		} else if err != nil {
+			job.Status = models.JobStatusFailed
+			job.Error = err.Error()
+			p.logger.WarnContext(jobCtx, "Job failed", "duration", executionTime, "error", err)
+		} else {
+			job.Status = models.JobStatusCompleted
+			job.Subdomains = result.Subdomains
+			job.Stats = &models.JobStats{
+				TotalFound:    len(result.Subdomains),
+				ExecutionTime: executionTime.String(),
+				SourcesUsed:   result.SourcesUsed,
+				Sources:       result.Sources,
+			}
+			job.Diff = jobDiff
+			p.logger.InfoContext(jobCtx, "Job completed", "duration", executionTime, "subdomains", len(result.Subdomains))
+		}
+	})
+	if job != nil {
+		p.queue.Publish(job.ID, queue.Event{Type: queue.EventStatus, Status: job.Status})
+	}
+}
+
+// compareWithPrevious returns the difference between the previous completed
+// scan of the job's domain and the subdomains it found, or nil if there is no
+// previous scan. Only the previous job is read in full.
+func (p *WorkerPool) compareWithPrevious(ctx context.Context, job *models.Job, subdomains []models.SubdomainInfo, completedAt time.Time) *models.JobDiff {
+	current := *job
+	current.Subdomains = subdomains
+	current.CompletedAt = &completedAt
+
+	summary := diff.Previous(p.queue.Summaries(), &current)
+	if summary == nil {
+		return nil
+	}
+	previous, ok := p.queue.Get(summary.ID)
+	if !ok {
+		return nil
+	}
+
+	result := diff.Compare(previous, &current)
+	p.logger.InfoContext(ctx, "Job compared with previous job", "previous_job_id", previous.ID, "added", len(result.Added), "removed", len(result.Removed), "ip_changed", len(result.IPChanged))
+	return result
+}
+
+// Partial results of a running job are stored once this many are pending or
+// this much time has passed, instead of rewriting the stored job for every
+// subdomain found
+const (
+	partialFlushSize     = 1000
+	partialFlushInterval = 2 * time.Second
+)
+
+// resultBuffer collects the subdomains found by a running job until they are
+// appended to the stored job
+type resultBuffer struct {
+	pool    *WorkerPool
+	ctx     context.Context
+	id      string
+	pending []models.SubdomainInfo
+	mutex   sync.Mutex
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// bufferResults starts storing the partial results of a job every partialFlushInterval
+func (p *WorkerPool) bufferResults(ctx context.Context, id string) *resultBuffer {
+	b := &resultBuffer{
+		pool:    p,
+		ctx:     ctx,
+		id:      id,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(b.stopped)
+
+		ticker := time.NewTicker(partialFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.done:
+				return
+			case <-ticker.C:
+				b.flush()
+			}
 		}
-		p.logger.Printf("Job %s completed in %s: found %d subdomains", job.ID, executionTime.String(), len(subdomains))
+	}()
+	return b
+}
+
+// add buffers a result, storing the pending results once partialFlushSize are buffered
+func (b *resultBuffer) add(info models.SubdomainInfo) {
+	b.mutex.Lock()
+	b.pending = append(b.pending, info)
+	full := len(b.pending) >= partialFlushSize
+	b.mutex.Unlock()
+
+	if full {
+		b.flush()
 	}
+}
+
+// flush appends the pending results to the stored job
+func (b *resultBuffer) flush() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
 
-	p.queue.Update(job)
+	if len(b.pending) == 0 {
+		return
+	}
+	pending := b.pending
+	b.pending = nil
+	b.pool.updateJob(b.ctx, b.id, func(job *models.Job) {
+		job.Subdomains = append(job.Subdomains, pending...)
+	})
+}
+
+// stop stops storing partial results and returns the results that were not stored yet
+func (b *resultBuffer) stop() []models.SubdomainInfo {
+	close(b.done)
+	<-b.stopped
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	pending := b.pending
+	b.pending = nil
+	return pending
+}
+
+// updateJob applies fn to the stored job and returns the updated copy, logging
+// any store failure
+func (p *WorkerPool) updateJob(ctx context.Context, id string, fn func(job *models.Job)) *models.Job {
+	job, err := p.queue.Update(id, func(job *models.Job) error {
+		fn(job)
+		return nil
+	})
+	if err != nil {
+		p.logger.ErrorContext(ctx, "Failed to update job", "error", err)
+		return nil
+	}
+	return job
 }
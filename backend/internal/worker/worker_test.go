@@ -0,0 +1,219 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/user/subfinder-service/backend/internal/queue"
+	"github.com/user/subfinder-service/backend/internal/subfinder"
+	"github.com/user/subfinder-service/backend/pkg/models"
+)
+
+// fakeEnumerator reports count subdomains per domain, pausing between them.
+// Domains starting with "slow." run until their context is done.
+type fakeEnumerator struct {
+	count int
+	pause time.Duration
+}
+
+// FindSubdomains implements subfinder.Enumerator
+func (e *fakeEnumerator) FindSubdomains(ctx context.Context, domain string, config models.SubfinderConfig, onResult func(models.SubdomainInfo)) (*subfinder.Result, error) {
+	result := &subfinder.Result{SourcesUsed: []string{"fake"}}
+	for i := 0; ; i++ {
+		if i == e.count && !strings.HasPrefix(domain, "slow.") {
+			return result, nil
+		}
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(e.pause):
+		}
+		info := models.SubdomainInfo{Subdomain: fmt.Sprintf("%d.%s", i, domain), Source: "fake", Sources: []string{"fake"}}
+		result.Subdomains = append(result.Subdomains, info)
+		onResult(info)
+	}
+}
+
+// waitFinished waits until all jobs have a final status and returns them
+func waitFinished(t *testing.T, q *queue.JobQueue, ids []string) map[string]*models.Job {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		jobs := make(map[string]*models.Job, len(ids))
+		for _, id := range ids {
+			if job, ok := q.Get(id); ok && job.Status.IsFinal() {
+				jobs[id] = job
+			}
+		}
+		if len(jobs) == len(ids) {
+			return jobs
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d jobs finished", len(jobs), len(ids))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWorkerPoolProcessesConcurrentSubmissions(t *testing.T) {
+	q := queue.NewJobQueue(queue.NewMemoryStore(), queue.DefaultCapacity)
+	pool := NewWorkerPool(4, q, &fakeEnumerator{count: 20, pause: time.Millisecond}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx, cancel := context.WithCancel(context.Background())
+	pool.Start(ctx)
+	defer func() {
+		cancel()
+		pool.Wait()
+	}()
+
+	// Submit jobs from several goroutines while others read and stream them
+	const submitters, perSubmit = 4, 10
+	var mutex sync.Mutex
+	var ids []string
+	var wg sync.WaitGroup
+	for s := 0; s < submitters; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			for i := 0; i < perSubmit; i++ {
+				domain := fmt.Sprintf("d%d-%d.example.com", s, i)
+				if s == 0 && i == 0 {
+					domain = "slow.example.com"
+				}
+				job := &models.Job{ID: domain, Domain: domain, Status: models.JobStatusQueued, CreatedAt: time.Now(), Priority: models.JobPriorityNormal}
+				if err := q.Enqueue(job); err != nil {
+					t.Errorf("enqueue: %v", err)
+					continue
+				}
+				mutex.Lock()
+				ids = append(ids, job.ID)
+				mutex.Unlock()
+
+				events, unsubscribe := q.Subscribe(job.ID)
+				wg.Add(1)
+				go func(id string) {
+					defer wg.Done()
+					defer unsubscribe()
+					for {
+						select {
+						case event, ok := <-events:
+							if !ok {
+								t.Errorf("events of %s were dropped", id)
+								return
+							}
+							if event.Type == queue.EventStatus && event.Status.IsFinal() {
+								return
+							}
+						case <-time.After(10 * time.Second):
+							t.Errorf("no final status event for %s", id)
+							return
+						}
+						q.Get(id)
+					}
+				}(job.ID)
+			}
+		}(s)
+	}
+
+	// Cancel the job that never finishes on its own once it runs
+	go func() {
+		for {
+			if job, ok := q.Get("slow.example.com"); ok && job.Status == models.JobStatusRunning && len(job.Subdomains) > 0 {
+				q.Cancel(job.ID)
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+	wg.Wait()
+
+	jobs := waitFinished(t, q, ids)
+	for id, job := range jobs {
+		if id == "slow.example.com" {
+			if job.Status != models.JobStatusCanceled {
+				t.Errorf("job %s has status %s, want canceled", id, job.Status)
+			}
+			if len(job.Subdomains) == 0 {
+				t.Errorf("canceled job %s lost its partial results", id)
+			}
+			continue
+		}
+		if job.Status != models.JobStatusCompleted {
+			t.Errorf("job %s has status %s, want completed", id, job.Status)
+		}
+		if len(job.Subdomains) != 20 || job.Stats == nil || job.Stats.TotalFound != 20 {
+			t.Errorf("job %s has %d subdomains, want 20", id, len(job.Subdomains))
+		}
+	}
+}
+
+func TestWorkerPoolStoresPartialResults(t *testing.T) {
+	q := queue.NewJobQueue(queue.NewMemoryStore(), queue.DefaultCapacity)
+	pool := NewWorkerPool(1, q, &fakeEnumerator{pause: time.Millisecond}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx, cancel := context.WithCancel(context.Background())
+	pool.Start(ctx)
+	defer func() {
+		cancel()
+		pool.Wait()
+	}()
+
+	job := &models.Job{ID: "slow", Domain: "slow.example.com", Status: models.JobStatusQueued, CreatedAt: time.Now()}
+	if err := q.Enqueue(job); err != nil {
+		t.Fatal(err)
+	}
+
+	// Results of a running job are stored within the flush interval
+	deadline := time.Now().Add(2 * partialFlushInterval)
+	for {
+		stored, _ := q.Get(job.ID)
+		if stored.Status == models.JobStatusRunning && len(stored.Subdomains) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no partial results stored while the job runs")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := q.Cancel(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitFinished(t, q, []string{job.ID})
+}
+
+func TestWorkerPoolComparesWithPreviousScan(t *testing.T) {
+	q := queue.NewJobQueue(queue.NewMemoryStore(), queue.DefaultCapacity)
+	pool := NewWorkerPool(1, q, &fakeEnumerator{count: 3}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx, cancel := context.WithCancel(context.Background())
+	pool.Start(ctx)
+	defer func() {
+		cancel()
+		pool.Wait()
+	}()
+
+	// Scans of the same domain run one after the other
+	for _, id := range []string{"first", "second"} {
+		job := &models.Job{ID: id, Domain: "example.com", Status: models.JobStatusQueued, CreatedAt: time.Now()}
+		if err := q.Enqueue(job); err != nil {
+			t.Fatal(err)
+		}
+		waitFinished(t, q, []string{id})
+	}
+
+	first, _ := q.Get("first")
+	if first.Diff != nil {
+		t.Errorf("first scan has a diff: %+v", first.Diff)
+	}
+	second, _ := q.Get("second")
+	if second.Diff == nil || second.Diff.FromJobID != "first" {
+		t.Fatalf("second scan was not compared with the first: %+v", second.Diff)
+	}
+	if len(second.Diff.Added) != 0 || len(second.Diff.Removed) != 0 {
+		t.Errorf("scans with the same results differ: %+v", second.Diff)
+	}
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+)
+
+// APIKey represents a key that grants access to the API. Only a hash of the
+// key itself is stored.
+type APIKey struct {
+	// Unique identifier for the key
+	ID string `json:"key_id"`
+
+	// Human-readable name of the key owner or purpose
+	Name string `json:"name"`
+
+	// Tenant whose jobs the key can access
+	Tenant string `json:"tenant"`
+
+	// First characters of the key, to help recognize it
+	Prefix string `json:"prefix"`
+
+	// SHA-256 hash of the key, never returned by the API
+	Hash string `json:"hash,omitempty"`
+
+	// Maximum number of queued and running jobs, 0 means unlimited
+	MaxConcurrentJobs int `json:"max_concurrent_jobs"`
+
+	// Maximum number of jobs submitted per UTC day, 0 means unlimited
+	MaxJobsPerDay int `json:"max_jobs_per_day"`
+
+	// Time when the key was created
+	CreatedAt time.Time `json:"created_at"`
+
+	// Time when the key was revoked
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// APIKeyRequest represents a request to create an API key
+type APIKeyRequest struct {
+	// Human-readable name of the key owner or purpose
+	Name string `json:"name" binding:"required"`
+
+	// Tenant whose jobs the key can access, defaults to the name
+	Tenant string `json:"tenant"`
+
+	// Maximum number of queued and running jobs, 0 means unlimited
+	MaxConcurrentJobs int `json:"max_concurrent_jobs"`
+
+	// Maximum number of jobs submitted per UTC day, 0 means unlimited
+	MaxJobsPerDay int `json:"max_jobs_per_day"`
+}
+
+// APIKeyResponse represents a newly created API key. The key itself is only
+// returned once.
+type APIKeyResponse struct {
+	APIKey
+
+	// The API key to send in the X-API-Key or Authorization header
+	Key string `json:"key"`
+}
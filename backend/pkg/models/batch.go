@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+)
+
+// Batch represents a group of jobs submitted together with a shared configuration
+type Batch struct {
+	// Unique identifier for the batch
+	ID string `json:"batch_id"`
+
+	// Domains submitted with the batch
+	Domains []string `json:"domains"`
+
+	// Configuration options shared by all jobs of the batch
+	Config SubfinderConfig `json:"config"`
+
+	// IDs of the child jobs, in the same order as Domains
+	JobIDs []string `json:"job_ids"`
+
+	// Time when the batch was created
+	CreatedAt time.Time `json:"created_at"`
+
+	// Tenant that owns the batch, empty when authentication is disabled
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// BatchRequest represents a request to create a batch of jobs
+type BatchRequest struct {
+	// Domains to search for subdomains
+	Domains []string `json:"domains"`
+
+	// Configuration options shared by all jobs
+	Config SubfinderConfig `json:"config"`
+
+	// Priority of all jobs: "high", "normal" (default) or "low"
+	Priority JobPriority `json:"priority"`
+}
+
+// BatchProgress represents the aggregate progress of the jobs of a batch
+type BatchProgress struct {
+	Total     int `json:"total"`
+	Queued    int `json:"queued"`
+	Running   int `json:"running"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+	Canceled  int `json:"canceled"`
+
+	// Jobs deleted by the retention policy or through the API, counted as finished
+	Purged int `json:"purged"`
+
+	// Percentage of jobs that reached a final status
+	Percent float64 `json:"percent"`
+
+	// Whether all jobs reached a final status
+	Done bool `json:"done"`
+}
+
+// BatchJob represents a child job in a batch status response
+type BatchJob struct {
+	JobID      string    `json:"job_id"`
+	Domain     string    `json:"domain"`
+	Status     JobStatus `json:"status,omitempty"`
+	TotalFound int       `json:"total_found"`
+	Error      string    `json:"error,omitempty"`
+
+	// Whether the job was deleted; deleted jobs have no status
+	Purged bool `json:"purged,omitempty"`
+}
+
+// BatchStatus represents a batch with the progress of its jobs
+type BatchStatus struct {
+	Batch
+	Progress BatchProgress `json:"progress"`
+	Jobs     []BatchJob    `json:"jobs"`
+}
+
+// BatchSubdomain represents a subdomain in the merged results of a batch
+type BatchSubdomain struct {
+	SubdomainInfo
+
+	// Domain of the job that found the subdomain
+	Domain string `json:"domain"`
+
+	// ID of the job that found the subdomain
+	JobID string `json:"job_id"`
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"time"
+)
+
+// Summary returns a deep copy of the job without its subdomains, log and diff,
+// for callers that only look at its status and timestamps
+func (j *Job) Summary() *Job {
+	if j == nil {
+		return nil
+	}
+
+	c := *j
+	c.Subdomains = nil
+	c.Log = nil
+	c.Diff = nil
+	return c.Clone()
+}
+
+// Clone returns a deep copy of the job that shares no memory with the original
+func (j *Job) Clone() *Job {
+	if j == nil {
+		return nil
+	}
+
+	c := *j
+	c.Config.Sources = cloneStrings(j.Config.Sources)
+	c.StartedAt = cloneTime(j.StartedAt)
+	c.CompletedAt = cloneTime(j.CompletedAt)
+	c.EstimatedCompletionTime = cloneTime(j.EstimatedCompletionTime)
+	c.Subdomains = cloneInfos(j.Subdomains)
+	c.Log = cloneStrings(j.Log)
+
+	if j.Stats != nil {
+		stats := *j.Stats
+		stats.SourcesUsed = cloneStrings(j.Stats.SourcesUsed)
+		if j.Stats.Sources != nil {
+			stats.Sources = make([]SourceStats, len(j.Stats.Sources))
+			for i, source := range j.Stats.Sources {
+				source.ErrorMessages = cloneStrings(source.ErrorMessages)
+				stats.Sources[i] = source
+			}
+		}
+		c.Stats = &stats
+	}
+	if j.Queue != nil {
+		queue := *j.Queue
+		c.Queue = &queue
+	}
+	if j.Diff != nil {
+		diff := *j.Diff
+		diff.Added = cloneInfos(j.Diff.Added)
+		diff.Removed = cloneInfos(j.Diff.Removed)
+		if j.Diff.IPChanged != nil {
+			diff.IPChanged = append([]SubdomainChange(nil), j.Diff.IPChanged...)
+		}
+		c.Diff = &diff
+	}
+	if j.Webhook != nil {
+		webhook := *j.Webhook
+		if j.Webhook.Attempts != nil {
+			webhook.Attempts = append([]WebhookAttempt(nil), j.Webhook.Attempts...)
+		}
+		c.Webhook = &webhook
+	}
+	if j.TraceContext != nil {
+		c.TraceContext = make(map[string]string, len(j.TraceContext))
+		for key, value := range j.TraceContext {
+			c.TraceContext[key] = value
+		}
+	}
+
+	return &c
+}
+
+// Clone returns a deep copy of the batch
+func (b *Batch) Clone() *Batch {
+	if b == nil {
+		return nil
+	}
+
+	c := *b
+	c.Domains = cloneStrings(b.Domains)
+	c.Config.Sources = cloneStrings(b.Config.Sources)
+	c.JobIDs = cloneStrings(b.JobIDs)
+	return &c
+}
+
+// cloneInfos copies subdomains along with their source lists
+func cloneInfos(infos []SubdomainInfo) []SubdomainInfo {
+	if infos == nil {
+		return nil
+	}
+	copied := make([]SubdomainInfo, len(infos))
+	for i, info := range infos {
+		info.Sources = cloneStrings(info.Sources)
+		copied[i] = info
+	}
+	return copied
+}
+
+// cloneStrings copies a string slice, keeping nil slices nil
+func cloneStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string(nil), values...)
+}
+
+// cloneTime copies a time pointer
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	copied := *t
+	return &copied
+}
@@ -12,8 +12,37 @@ const (
 	JobStatusRunning   JobStatus = "running"
 	JobStatusCompleted JobStatus = "completed"
 	JobStatusFailed    JobStatus = "failed"
+	JobStatusCanceled  JobStatus = "canceled"
 )
 
+// IsFinal reports whether the status is terminal and the job will not change anymore
+func (s JobStatus) IsFinal() bool {
+	return s == JobStatusCompleted || s == JobStatusFailed || s == JobStatusCanceled
+}
+
+// JobPriority selects the queue lane of a job
+type JobPriority string
+
+const (
+	JobPriorityHigh   JobPriority = "high"
+	JobPriorityNormal JobPriority = "normal"
+	JobPriorityLow    JobPriority = "low"
+)
+
+// Valid reports whether the priority is one of the known lanes
+func (p JobPriority) Valid() bool {
+	return p == JobPriorityHigh || p == JobPriorityNormal || p == JobPriorityLow
+}
+
+// QueueInfo describes where a queued job waits
+type QueueInfo struct {
+	// Lane the job waits in
+	Lane JobPriority `json:"lane"`
+
+	// Position of the job in the order jobs will be started, starting at 1
+	Position int `json:"position"`
+}
+
 // SubfinderConfig represents the configuration options for subfinder
 type SubfinderConfig struct {
 	// Maximum depth level for subdomains (e.g., 2 would include a.example.com and a.b.example.com)
@@ -42,6 +71,29 @@ type SubfinderConfig struct {
 	ExcludeWww bool `json:"exclude_www"`
 }
 
+// DefaultSubfinderConfig returns the defaults of the options used unless the service is configured otherwise
+func DefaultSubfinderConfig() SubfinderConfig {
+	return SubfinderConfig{
+		MaxDepth:  1,
+		Timeout:   60,
+		RateLimit: 10,
+	}
+}
+
+// ApplyDefaults sets the options that were not provided to those of defaults
+func (c *SubfinderConfig) ApplyDefaults(defaults SubfinderConfig) {
+	if c.MaxDepth <= 0 {
+		c.MaxDepth = defaults.MaxDepth
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaults.Timeout
+	}
+	if c.RateLimit <= 0 {
+		c.RateLimit = defaults.RateLimit
+	}
+	// ExcludeWww is false by default, so no need to set it explicitly
+}
+
 // Job represents a subfinder job
 type Job struct {
 	// Unique identifier for the job
@@ -76,13 +128,74 @@ type Job struct {
 
 	// Statistics about the job
 	Stats *JobStats `json:"stats,omitempty"`
+
+	// Diagnostic output of subfinder that is not a result, such as banners and warnings
+	Log []string `json:"log,omitempty"`
+
+	// ID of the schedule that created the job, empty for jobs submitted through the API
+	ScheduleID string `json:"schedule_id,omitempty"`
+
+	// ID of the batch the job belongs to, if any
+	BatchID string `json:"batch_id,omitempty"`
+
+	// ID of the API key that submitted the job, empty when authentication is disabled
+	APIKeyID string `json:"api_key_id,omitempty"`
+
+	// Tenant that owns the job, empty when authentication is disabled
+	Tenant string `json:"tenant,omitempty"`
+
+	// Priority of the job, which selects its queue lane
+	Priority JobPriority `json:"priority,omitempty"`
+
+	// Lane and position of the job while it is queued, only set in API responses
+	Queue *QueueInfo `json:"queue,omitempty"`
+
+	// Changes since the previous completed job for the same domain
+	Diff *JobDiff `json:"diff,omitempty"`
+
+	// Notification sent when the job finishes
+	Webhook *Webhook `json:"webhook,omitempty"`
+
+	// ID of the trace that follows the job from submission to completion
+	TraceID string `json:"trace_id,omitempty"`
+
+	// W3C trace context of the submission, used to continue the trace when the job runs
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+}
+
+// Webhook represents the callback notified when a job is completed, failed or canceled
+type Webhook struct {
+	// URL the notification is posted to
+	URL string `json:"url"`
+
+	// Secret used to sign the payload. It is stored with the job but never returned by the API.
+	Secret string `json:"secret,omitempty"`
+
+	// Whether the notification was accepted by the receiver
+	Delivered bool `json:"delivered"`
+
+	// Delivery attempts made so far
+	Attempts []WebhookAttempt `json:"attempts,omitempty"`
+}
+
+// WebhookAttempt represents a single delivery attempt of a webhook notification
+type WebhookAttempt struct {
+	// Time of the attempt
+	Time time.Time `json:"time"`
+
+	// HTTP status code returned by the receiver, if any
+	StatusCode int `json:"status_code,omitempty"`
+
+	// Error that prevented delivery, if any
+	Error string `json:"error,omitempty"`
 }
 
 // SubdomainInfo represents a single found subdomain with its details
 type SubdomainInfo struct {
-	Subdomain string `json:"subdomain"`
-	IP        string `json:"ip,omitempty"` // Included only if config.include_ips is true
-	Source    string `json:"source"`
+	Subdomain string   `json:"subdomain"`
+	IP        string   `json:"ip,omitempty"` // Included only if config.include_ips is true
+	Source    string   `json:"source"`       // First source that reported the subdomain
+	Sources   []string `json:"sources,omitempty"`
 }
 
 // JobStats represents statistics about a job
@@ -95,6 +208,55 @@ type JobStats struct {
 
 	// Sources used to find subdomains
 	SourcesUsed []string `json:"sources_used"`
+
+	// Per-source breakdown of results and errors
+	Sources []SourceStats `json:"sources,omitempty"`
+}
+
+// SourceStats represents statistics about a single subfinder source
+type SourceStats struct {
+	// Name of the source
+	Source string `json:"source"`
+
+	// Number of unique subdomains reported by the source
+	Found int `json:"found"`
+
+	// Time the source took to finish
+	Duration string `json:"duration,omitempty"`
+
+	// Number of errors reported by the source
+	Errors int `json:"errors"`
+
+	// Error messages reported by the source, if available
+	ErrorMessages []string `json:"error_messages,omitempty"`
+
+	// Whether the source was skipped because it requires an API key that is not configured
+	SkippedMissingKey bool `json:"skipped_missing_key,omitempty"`
+}
+
+// JobDiff represents the differences between the results of two jobs
+type JobDiff struct {
+	// Job the comparison starts from
+	FromJobID string `json:"from_job_id"`
+
+	// Job the comparison ends at
+	ToJobID string `json:"to_job_id"`
+
+	// Subdomains found by the second job but not the first
+	Added []SubdomainInfo `json:"added"`
+
+	// Subdomains found by the first job but not the second
+	Removed []SubdomainInfo `json:"removed"`
+
+	// Subdomains found by both jobs whose IP address changed
+	IPChanged []SubdomainChange `json:"ip_changed"`
+}
+
+// SubdomainChange represents a change of the IP address of a subdomain
+type SubdomainChange struct {
+	Subdomain string `json:"subdomain"`
+	OldIP     string `json:"old_ip"`
+	NewIP     string `json:"new_ip"`
 }
 
 // JobRequest represents a request to create a new job
@@ -104,6 +266,15 @@ type JobRequest struct {
 	
 	// Configuration options for subfinder
 	Config SubfinderConfig `json:"config"`
+
+	// Optional URL notified when the job is completed, failed or canceled
+	CallbackURL string `json:"callback_url"`
+
+	// Optional secret used to sign the notification with HMAC-SHA256
+	CallbackSecret string `json:"callback_secret"`
+
+	// Priority of the job: "high", "normal" (default) or "low"
+	Priority JobPriority `json:"priority"`
 }
 
 // JobResponse represents a response to a job request
@@ -116,4 +287,17 @@ type JobResponse struct {
 	
 	// Estimated time when the job will be completed
 	EstimatedCompletionTime *time.Time `json:"estimated_completion_time,omitempty"`
+
+	// ID of the trace that follows the job
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// JobSummary represents a job in job lists, without its results
+type JobSummary struct {
+	JobID       string     `json:"job_id"`
+	Domain      string     `json:"domain"`
+	Status      JobStatus  `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
 }
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+)
+
+// ProviderKey represents an API key for a subfinder passive source. The key
+// itself is only stored encrypted.
+type ProviderKey struct {
+	// Unique identifier for the key
+	ID string `json:"key_id"`
+
+	// Lower-case name of the passive source, e.g. "shodan"
+	Source string `json:"source"`
+
+	// Last characters of the key, to help recognize it
+	Hint string `json:"hint"`
+
+	// Encrypted key, never returned by the API
+	Ciphertext []byte `json:"ciphertext,omitempty"`
+
+	// Time when the key was added
+	CreatedAt time.Time `json:"created_at"`
+
+	// Time when the key was last replaced
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+}
+
+// ProviderKeyRequest represents a request to add or rotate a provider key
+type ProviderKeyRequest struct {
+	// API key in the format subfinder expects for the source, e.g. "user:secret" for censys
+	Key string `json:"key" binding:"required"`
+}
+
+// ProviderSource lists the keys configured for a passive source
+type ProviderSource struct {
+	// Lower-case name of the passive source
+	Source string `json:"source"`
+
+	// Keys configured for the source
+	Keys []*ProviderKey `json:"keys"`
+}
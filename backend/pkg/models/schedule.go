@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+)
+
+// Schedule represents a recurring scan of a domain
+type Schedule struct {
+	// Unique identifier for the schedule
+	ID string `json:"schedule_id"`
+
+	// Domain to search for subdomains
+	Domain string `json:"domain"`
+
+	// Configuration options for subfinder
+	Config SubfinderConfig `json:"config"`
+
+	// Cron expression defining when the scan runs (e.g., "0 2 * * *" or "@daily")
+	Cron string `json:"cron"`
+
+	// Whether the schedule creates jobs
+	Enabled bool `json:"enabled"`
+
+	// Time when the schedule was created
+	CreatedAt time.Time `json:"created_at"`
+
+	// Time when the schedule was last changed
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Time when the schedule last created a job
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+
+	// ID of the last job created by the schedule
+	LastJobID string `json:"last_job_id,omitempty"`
+
+	// Error from the last attempt to create a job, if it failed
+	LastError string `json:"last_error,omitempty"`
+
+	// Time when the schedule will fire next, only set for enabled schedules
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+
+	// Tenant that owns the schedule and the jobs it creates
+	Tenant string `json:"tenant,omitempty"`
+
+	// ID of the API key that created the schedule, whose quota its jobs count against
+	APIKeyID string `json:"api_key_id,omitempty"`
+}
+
+// ScheduleRequest represents a request to create or replace a schedule
+type ScheduleRequest struct {
+	// Domain to search for subdomains
+	Domain string `json:"domain" binding:"required"`
+
+	// Configuration options for subfinder
+	Config SubfinderConfig `json:"config"`
+
+	// Cron expression defining when the scan runs
+	Cron string `json:"cron" binding:"required"`
+
+	// Whether the schedule creates jobs, defaults to true
+	Enabled *bool `json:"enabled"`
+}
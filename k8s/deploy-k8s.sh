@@ -70,11 +70,13 @@ kubectl apply -f frontend/configmap.yaml -n ${NAMESPACE}
 
 # Apply Services
 echo -e "\n${YELLOW}Applying Services...${NC}"
+kubectl apply -f redis/service.yaml -n ${NAMESPACE}
 kubectl apply -f backend/service.yaml -n ${NAMESPACE}
 kubectl apply -f frontend/service.yaml -n ${NAMESPACE}
 
 # Apply Deployments with image substitution
 echo -e "\n${YELLOW}Applying Deployments...${NC}"
+kubectl apply -f redis/deployment.yaml -n ${NAMESPACE}
 cat backend/deployment.yaml | sed "s|\${BACKEND_IMAGE:-subfinder-backend:latest}|${BACKEND_IMAGE}|g" | kubectl apply -f - -n ${NAMESPACE}
 cat frontend/deployment.yaml | sed "s|\${FRONTEND_IMAGE:-subfinder-frontend:latest}|${FRONTEND_IMAGE}|g" | kubectl apply -f - -n ${NAMESPACE}
 